@@ -0,0 +1,119 @@
+// Command admin makes requests to the admin endpoints of post-pigeon, signed with the private key of an operator:
+//
+//	admin -key operator.pem [-addr http://localhost:8081] METHOD PATH [name=value...]
+//
+// Any name=value pairs are sent as a form, e.g.
+//
+//	admin -key operator.pem POST /bans/<fingerprint> reason=spam
+//
+// or, with -file, the contents of a file are sent as they are instead, e.g. to import an archive
+//
+//	admin -key operator.pem -file post-pigeon-<fingerprint>.tar.gz POST /imports
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/jtanza/post-pigeon/internal"
+)
+
+func main() {
+	keyPath := flag.String("key", "", "path to the PEM encoded private key of an operator")
+	addr := flag.String("addr", "http://localhost:8081", "address of the admin endpoints")
+	file := flag.String("file", "", "path to a file to send as the body, in place of any name=value pairs")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s -key operator.pem [-addr url] [-file path] METHOD PATH [name=value...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if len(*keyPath) == 0 || flag.NArg() < 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if len(*file) > 0 && flag.NArg() > 2 {
+		fmt.Fprintln(os.Stderr, "admin: -file can't be combined with name=value pairs")
+		os.Exit(2)
+	}
+
+	if err := run(*keyPath, *addr, *file, flag.Arg(0), flag.Arg(1), flag.Args()[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "admin: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(keyPath, addr, file, method, path string, params []string) error {
+	pemData, err := os.ReadFile(keyPath)
+	if err != nil {
+		return err
+	}
+	key, err := internal.ParsePrivateKey(pemData)
+	if err != nil {
+		return err
+	}
+
+	body, contentType, err := requestBody(file, params)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest(strings.ToUpper(method), strings.TrimSuffix(addr, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if len(body) > 0 {
+		request.Header.Set("Content-Type", contentType)
+	}
+	request.Header.Set("Accept", "application/json")
+	if err = internal.SignAdminRequest(request, body, key); err != nil {
+		return err
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if _, err = io.Copy(os.Stdout, response.Body); err != nil {
+		return err
+	}
+	if response.StatusCode >= 400 {
+		return fmt.Errorf("%s", response.Status)
+	}
+	return nil
+}
+
+// requestBody returns the body of the request along with its content type: the contents of file if there is one,
+// params encoded as a form otherwise
+func requestBody(file string, params []string) ([]byte, string, error) {
+	if len(file) > 0 {
+		body, err := os.ReadFile(file)
+		if err != nil {
+			return nil, "", err
+		}
+		contentType := "application/octet-stream"
+		if strings.HasSuffix(file, ".gz") {
+			contentType = "application/gzip"
+		}
+		return body, contentType, nil
+	}
+
+	form := url.Values{}
+	for _, param := range params {
+		name, value, ok := strings.Cut(param, "=")
+		if !ok {
+			return nil, "", fmt.Errorf("invalid parameter %q, expected name=value", param)
+		}
+		form.Add(name, value)
+	}
+	return []byte(form.Encode()), "application/x-www-form-urlencoded", nil
+}
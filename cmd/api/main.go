@@ -4,9 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"github.com/bluele/gcache"
 	"github.com/jtanza/post-pigeon/internal"
-	"github.com/labstack/gommon/log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -16,49 +15,77 @@ import (
 const cacheSize = 50
 
 func main() {
-	logFile, err := os.OpenFile("log/postpigeon.log", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	logger, logOutput, err := internal.NewLogger()
 	if err != nil {
-		panic(fmt.Sprintf("error opening file: %v", err))
+		fmt.Fprintf(os.Stderr, "could not set up logging: %v\n", err)
+		os.Exit(1)
 	}
-	defer logFile.Close()
+	defer logOutput.Close()
 
-	log.SetOutput(logFile)
+	slog.SetDefault(logger)
 
 	db := internal.NewDB()
-	go reapPosts(db)
-
-	cache := gcache.New(cacheSize).LRU().Build()
-	r := internal.NewRouter(db, internal.NewPostManager(db, cache)).Engine(logFile)
+	if err = internal.LoadTemplates(); err != nil {
+		internal.Fatal("could not load templates", "error", err)
+	}
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer stop()
 
+	rateLimitStore := internal.NewRateLimitStore(db)
+	pm := internal.NewPostManager(db, internal.NewPostCache(cacheSize), internal.NewQuotas(rateLimitStore))
+	scheduler := internal.NewScheduler(
+		internal.ExpiredPostsJob(pm),
+		internal.ScheduledPostsJob(db),
+		internal.ExpiredDraftsJob(db),
+		internal.DomainsJob(internal.NewDomainVerifier(db, internal.NewKeyFetcher())),
+		internal.RateLimitsJob(db),
+		internal.BlocklistJob(pm),
+		internal.AuditLogJob(pm),
+		internal.BackupJob(db),
+	)
+	scheduler.Start(ctx)
+
+	health := internal.NewHealth(db, pm)
+	r := internal.NewRouter(db, pm, health, internal.NewRateLimits(rateLimitStore), internal.NewChallenges(rateLimitStore)).Engine()
+	operatorKeys, err := internal.LoadOperatorKeys()
+	if err != nil {
+		internal.Fatal("could not load operator keys", "error", err)
+	}
+	admin := internal.NewAdminRouter(scheduler, pm, internal.NewOperatorAuth(operatorKeys, rateLimitStore)).Engine()
+
 	// Start server
 	go func() {
+		slog.Info("starting server")
 		if err = r.StartAutoTLS(":443"); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			log.Fatalf("shutting down the server %s", err)
+			internal.Fatal("shutting down the server", "error", err)
 		}
 		// redirects to 443 in prod
-		log.Fatal(r.Start(":80"))
+		if err = r.Start(":80"); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			internal.Fatal("shutting down the server", "error", err)
+		}
+	}()
+
+	go func() {
+		slog.Info("starting admin server", "addr", internal.AdminAddr())
+		if err := admin.Start(internal.AdminAddr()); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			internal.Fatal("shutting down the admin server", "error", err)
+		}
 	}()
 
 	// Wait for interrupt signal to gracefully shutdown the server with a timeout of 10 seconds.
 	<-ctx.Done()
-	log.Warn("interrupt received, shutting down")
+	slog.Warn("interrupt received, draining before shutting down")
+	health.Drain()
+	time.Sleep(internal.DrainPeriod())
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-	if err = r.Shutdown(ctx); err != nil {
-		log.Fatal(err)
+	if err = admin.Shutdown(ctx); err != nil {
+		slog.Error("could not shut down the admin server", "error", err)
 	}
-}
-
-func reapPosts(db internal.DB) {
-	for range time.Tick(time.Minute * 5) {
-		deleted, err := db.DeleteExpiredPosts()
-		if err != nil {
-			log.Error(err)
-		} else {
-			log.Infof("deleted %d expired posts", deleted)
-		}
+	if err = r.Shutdown(ctx); err != nil {
+		internal.Fatal("could not shut down the server", "error", err)
 	}
+	scheduler.Wait()
 }
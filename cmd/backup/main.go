@@ -0,0 +1,29 @@
+// Command backup writes a consistent copy of postpigeon.db to the backup dir, which is safe to run while the app
+// is, checking the integrity of the copy and dropping the oldest backups past those kept:
+//
+//	backup [-dir backups] [-keep 7]
+//
+// The dir and the number of backups kept default to POST_PIGEON_BACKUP_DIR and POST_PIGEON_BACKUP_KEEP
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/jtanza/post-pigeon/internal"
+)
+
+func main() {
+	dir := flag.String("dir", internal.BackupDir(), "dir to write the backup to")
+	keep := flag.Int("keep", internal.BackupKeep(), "number of backups to keep in dir, 0 keeps them all")
+	flag.Parse()
+
+	path, err := internal.Backup(context.Background(), internal.NewDB(), *dir, *keep)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "backup: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(path)
+}
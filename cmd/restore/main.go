@@ -0,0 +1,37 @@
+// Command restore replaces postpigeon.db with a backup, once it's checked to be intact and at the version of the
+// latest migration. The db it replaces is kept alongside it. Stop the app before restoring:
+//
+//	restore backups/postpigeon-20240501T030000Z.db
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/jtanza/post-pigeon/internal"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s BACKUP\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	replaced, err := internal.Restore(flag.Arg(0), internal.DBFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "restore: %v\n", err)
+		os.Exit(1)
+	}
+	if len(replaced) > 0 {
+		fmt.Printf("restored %s, the db it replaced was moved to %s\n", flag.Arg(0), replaced)
+	} else {
+		fmt.Printf("restored %s\n", flag.Arg(0))
+	}
+}
@@ -0,0 +1,301 @@
+package internal
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/jtanza/post-pigeon/internal/model"
+	"github.com/labstack/echo/v4"
+)
+
+const defaultAdminAddr = "localhost:8081"
+
+// AdminAddr is the address the admin endpoints listen on, configured through POST_PIGEON_ADMIN_ADDR. It defaults
+// to an address only reachable from the host itself
+func AdminAddr() string {
+	if addr := os.Getenv("POST_PIGEON_ADMIN_ADDR"); len(addr) > 0 {
+		return addr
+	}
+	return defaultAdminAddr
+}
+
+// AdminRouter serves the endpoints used to operate the app, on a listener of their own. All of them but /metrics
+// only serve requests signed by an operator, see OperatorAuth
+type AdminRouter struct {
+	scheduler   *Scheduler
+	postManager PostManager
+	auth        OperatorAuth
+}
+
+func NewAdminRouter(scheduler *Scheduler, postManager PostManager, auth OperatorAuth) AdminRouter {
+	return AdminRouter{scheduler, postManager, auth}
+}
+
+func (a AdminRouter) Engine() *echo.Echo {
+	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+	e.IPExtractor = IPExtractor()
+	e.Validator = &CustomValidator{validator: validator.New()}
+
+	e.Use(requestIDMiddleware())
+	e.Use(requestLogger())
+	e.Use(auditMiddleware())
+
+	e.GET("/metrics", serveMetrics)
+
+	g := e.Group("", a.auth.middleware())
+	g.GET("/jobs", a.getJobs)
+	g.GET("/jobs/:name", a.getJob)
+	g.POST("/jobs/:name/run", a.runJob)
+
+	g.GET("/moderation", a.getModerationQueue)
+	g.POST("/moderation/posts/:uuid/takedown", a.takeDownPost)
+	g.POST("/moderation/posts/:uuid/restore", a.restorePost)
+	g.POST("/moderation/posts/:uuid/dismiss", a.dismissReports)
+
+	g.GET("/bans", a.getBans)
+	g.POST("/bans/:fingerprint", a.banFingerprint)
+	g.DELETE("/bans/:fingerprint", a.unbanFingerprint)
+
+	g.GET("/blocklist", a.getBlocklist)
+	g.POST("/blocklist", a.block)
+	g.DELETE("/blocklist/:id", a.unblock)
+
+	g.GET("/audit", a.getAuditLog)
+
+	g.POST("/imports", a.importArchive)
+
+	g.GET("/backups", a.getBackups)
+
+	g.POST("/cache/purge", a.purgeCache)
+	g.GET("/stats", a.getStats)
+
+	return e
+}
+
+func (a AdminRouter) getJobs(c echo.Context) error {
+	return c.JSON(http.StatusOK, a.scheduler.Status())
+}
+
+func (a AdminRouter) getJob(c echo.Context) error {
+	status, err := a.scheduler.JobStatus(c.Param("name"))
+	if errors.Is(err, ErrUnknownJob) {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	return c.JSON(http.StatusOK, status)
+}
+
+// runJob triggers a job without waiting for it to be due. The job runs in the background, its status tells when it's done
+func (a AdminRouter) runJob(c echo.Context) error {
+	name := c.Param("name")
+	if err := a.scheduler.Trigger(name); errors.Is(err, ErrUnknownJob) {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if err := a.manager(c).Audit(AuditRunJob, a.actor(c), "", name); err != nil {
+		return err
+	}
+
+	status, err := a.scheduler.JobStatus(name)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusAccepted, status)
+}
+
+// manager returns the PostManager that serves the request in c
+func (a AdminRouter) manager(c echo.Context) PostManager {
+	return a.postManager.WithContext(c.Request().Context())
+}
+
+// actor names whoever an admin action is taken by, for the audit log: the fingerprint of the operator's key
+func (a AdminRouter) actor(c echo.Context) string {
+	return operator(c)
+}
+
+// getModerationQueue lists the reported posts awaiting moderation, as a page to act on them from or as json
+func (a AdminRouter) getModerationQueue(c echo.Context) error {
+	queue, err := a.manager(c).ModerationQueue()
+	if err != nil {
+		return err
+	}
+
+	if strings.Contains(c.Request().Header.Get(echo.HeaderAccept), echo.MIMEApplicationJSON) {
+		return c.JSON(http.StatusOK, queue)
+	}
+
+	page, err := toHTML("moderation", map[string]any{"Posts": queue})
+	if err != nil {
+		return err
+	}
+	return c.HTML(http.StatusOK, page)
+}
+
+// takeDownPost hides a post from everyone, resolving its reports
+func (a AdminRouter) takeDownPost(c echo.Context) error {
+	var request model.TakedownRequest
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := c.Validate(request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "A reason for the takedown is required")
+	}
+
+	return a.moderated(c, a.manager(c).TakeDownPost(c.Param("uuid"), request.Reason, a.actor(c)))
+}
+
+func (a AdminRouter) restorePost(c echo.Context) error {
+	return a.moderated(c, a.manager(c).RestorePost(c.Param("uuid"), a.actor(c)))
+}
+
+func (a AdminRouter) dismissReports(c echo.Context) error {
+	return a.moderated(c, a.manager(c).DismissReports(c.Param("uuid"), a.actor(c)))
+}
+
+// moderated answers a moderation action that ended with err, sending browsers back to the moderation queue
+func (a AdminRouter) moderated(c echo.Context, err error) error {
+	if errors.Is(err, ErrPostNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	} else if err != nil {
+		return err
+	}
+
+	if strings.Contains(c.Request().Header.Get(echo.HeaderAccept), echo.MIMEApplicationJSON) {
+		return c.NoContent(http.StatusNoContent)
+	}
+	return c.Redirect(http.StatusSeeOther, "/moderation")
+}
+
+func (a AdminRouter) getBans(c echo.Context) error {
+	bans, err := a.manager(c).FetchBans()
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, bans)
+}
+
+// banFingerprint bars a key from posting
+func (a AdminRouter) banFingerprint(c echo.Context) error {
+	var request model.BanRequest
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := c.Validate(request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "One or more fields missing or incorrect")
+	}
+
+	if err := a.manager(c).BanFingerprint(c.Param("fingerprint"), request.Reason, a.actor(c)); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (a AdminRouter) unbanFingerprint(c echo.Context) error {
+	if err := a.manager(c).UnbanFingerprint(c.Param("fingerprint"), a.actor(c)); errors.Is(err, ErrNotBlocklisted) {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	} else if err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// getBlocklist lists the blocklist, only the entries of the kind in the kind query param if there is one
+func (a AdminRouter) getBlocklist(c echo.Context) error {
+	entries, err := a.manager(c).FetchBlocklist(c.QueryParam("kind"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, entries)
+}
+
+// block adds a fingerprint, a hash of a body, a keyword or a pattern to the blocklist, taking effect right away
+func (a AdminRouter) block(c echo.Context) error {
+	var request model.BlocklistRequest
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := c.Validate(request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "One or more fields missing or incorrect")
+	}
+
+	if err := a.manager(c).Block(request.Kind, request.Value, request.Reason, a.actor(c)); errors.Is(err, ErrInvalidBlocklistEntry) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	} else if err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (a AdminRouter) unblock(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+
+	if err = a.manager(c).Unblock(id, a.actor(c)); errors.Is(err, ErrNotBlocklisted) {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	} else if err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// getAuditLog lists the entries of the audit log matching the filters in the query params, the latest first
+func (a AdminRouter) getAuditLog(c echo.Context) error {
+	var query model.AuditQuery
+	if err := c.Bind(&query); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := c.Validate(query); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "One or more query parameters incorrect")
+	}
+
+	entries, err := a.manager(c).FetchAuditLog(query)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, entries)
+}
+
+// importArchive imports the posts of an archive exported from this instance or another, sent as the body
+func (a AdminRouter) importArchive(c echo.Context) error {
+	result, err := a.manager(c).ImportArchive(c.Request().Body, a.actor(c))
+	if errors.Is(err, ErrInvalidArchive) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	} else if errors.Is(err, ErrBannedKey) || errors.Is(err, ErrBlockedContent) || errors.Is(err, ErrRetiredKey) {
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	} else if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// getBackups lists the backups of the db, the latest first. Backups are made by the backup job, which can be run
+// on demand through /jobs/backup/run
+func (a AdminRouter) getBackups(c echo.Context) error {
+	backups, err := ListBackups(BackupDir())
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, backups)
+}
+
+// purgeCache drops every post from the post cache, e.g. after editing posts in the db by hand
+func (a AdminRouter) purgeCache(c echo.Context) error {
+	if err := a.manager(c).PurgeCache(a.actor(c)); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (a AdminRouter) getStats(c echo.Context) error {
+	stats, err := a.manager(c).Stats()
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, stats)
+}
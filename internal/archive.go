@@ -0,0 +1,280 @@
+package internal
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jtanza/post-pigeon/internal/model"
+)
+
+const (
+	archiveVersion  = 1
+	archiveManifest = "manifest.json"
+	// maxArchiveSize caps the bytes an archive can unpack to, so that a small archive can't be made to unpack into
+	// more than can be held in memory
+	maxArchiveSize = 64 << 20
+)
+
+// ErrInvalidArchive is returned when importing an archive that isn't one, or holds a post that can't be verified
+var ErrInvalidArchive = errors.New("invalid archive")
+
+// ExportPosts writes every public post of the author with fingerprint, whichever of their keys it was signed by, to
+// w as a gzipped tar archive. The archive holds the markdown of each post exactly as it was signed, under posts/,
+// along with a manifest.json listing its title, uuid, key, signature, when it was created and when it expires, see
+// model.Archive. Returns false, writing nothing, when the author has no public posts
+func (pm PostManager) ExportPosts(fingerprint string, w io.Writer) (bool, error) {
+	history, err := pm.KeyHistory(fingerprint)
+	if err != nil {
+		return false, err
+	}
+
+	posts, err := pm.db.GetAuthorPosts(history.Fingerprints)
+	if err != nil || len(posts) == 0 {
+		return false, err
+	}
+
+	archive := model.Archive{
+		Version:     archiveVersion,
+		Fingerprint: history.Fingerprint,
+		ExportedAt:  time.Now().UTC(),
+		Posts:       make([]model.ArchivedPost, 0, len(posts)),
+	}
+	for _, post := range posts {
+		archive.Posts = append(archive.Posts, model.ArchivedPost{
+			UUID:        post.UUID,
+			Title:       post.Title,
+			File:        path.Join("posts", post.UUID+".md"),
+			Fingerprint: post.Fingerprint,
+			PublicKey:   post.Key,
+			Signature:   post.Signature,
+			CreatedAt:   post.CreatedAt,
+			ExpiresAt:   post.ExpiresAt,
+		})
+	}
+
+	manifest, err := json.MarshalIndent(archive, "", "  ")
+	if err != nil {
+		return false, err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	if err = writeArchiveFile(tw, archiveManifest, manifest, archive.ExportedAt); err != nil {
+		return false, err
+	}
+	for i, post := range posts {
+		if err = writeArchiveFile(tw, archive.Posts[i].File, []byte(post.Message), post.CreatedAt); err != nil {
+			return false, err
+		}
+	}
+	if err = tw.Close(); err != nil {
+		return false, err
+	}
+	return true, gz.Close()
+}
+
+func writeArchiveFile(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	header := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), ModTime: modTime, Typeflag: tar.TypeReg}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// ImportArchive imports the posts of an archive made by ExportPosts, on behalf of actor. Every post is verified
+// before any is imported: its signature must validate against its markdown and key, and it must pass the blocklist.
+// Posts keep the uuid, creation date and expiration they were exported with. Posts already on the instance, or
+// that have expired since, are skipped, so that an archive can be imported again safely
+func (pm PostManager) ImportArchive(r io.Reader, actor string) (*model.ImportResult, error) {
+	archive, files, err := readArchive(r)
+	if err != nil {
+		return nil, err
+	}
+
+	requests := make([]model.PostRequest, len(archive.Posts))
+	slugs := map[string]string{}
+	for i, post := range archive.Posts {
+		message, ok := files[post.File]
+		if !ok {
+			return nil, fmt.Errorf("%w: post %s: missing %s", ErrInvalidArchive, post.UUID, post.File)
+		}
+		request := model.PostRequest{Title: post.Title, Body: string(message), PublicKey: post.PublicKey, Signature: post.Signature}
+		if err = pm.verifyArchivedPost(post, request, slugs); err != nil {
+			return nil, err
+		}
+		requests[i] = request
+	}
+
+	result := &model.ImportResult{Imported: []string{}, Skipped: []string{}}
+	for i, post := range archive.Posts {
+		imported, err := pm.importPost(post, requests[i], actor)
+		if err != nil {
+			return nil, fmt.Errorf("could not import post %s: %w", post.UUID, err)
+		}
+		if imported {
+			result.Imported = append(result.Imported, post.UUID)
+		} else {
+			result.Skipped = append(result.Skipped, post.UUID)
+		}
+	}
+	return result, nil
+}
+
+// readArchive unpacks r, returning its manifest along with the contents of every other file in it by name
+func readArchive(r io.Reader) (*model.Archive, map[string][]byte, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	defer gz.Close()
+
+	files := map[string][]byte{}
+	remaining := int64(maxArchiveSize)
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		data, err := io.ReadAll(io.LimitReader(tr, remaining+1))
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		if remaining -= int64(len(data)); remaining < 0 {
+			return nil, nil, fmt.Errorf("%w: unpacks to more than %d bytes", ErrInvalidArchive, maxArchiveSize)
+		}
+		files[path.Clean(header.Name)] = data
+	}
+
+	manifest, ok := files[archiveManifest]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: missing %s", ErrInvalidArchive, archiveManifest)
+	}
+	var archive model.Archive
+	if err = json.Unmarshal(manifest, &archive); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	if archive.Version != archiveVersion {
+		return nil, nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidArchive, archive.Version)
+	}
+
+	for i := range archive.Posts {
+		archive.Posts[i].File = path.Clean(archive.Posts[i].File)
+	}
+	return &archive, files, nil
+}
+
+// verifyArchivedPost ensures post, to be created as request, was signed by the key it claims, and could be
+// created on this instance. slugs tracks the slugs claimed by the posts of the archive verified so far
+func (pm PostManager) verifyArchivedPost(post model.ArchivedPost, request model.PostRequest, slugs map[string]string) error {
+	invalid := func(reason string) error {
+		return fmt.Errorf("%w: post %s: %s", ErrInvalidArchive, post.UUID, reason)
+	}
+
+	if _, err := uuid.Parse(post.UUID); err != nil {
+		return invalid("malformed uuid")
+	}
+	if len(post.Title) == 0 {
+		return invalid("missing title")
+	}
+	if err := ValidateSignature(request.PublicKey, request.Signature, request.Body); err != nil {
+		return invalid("could not validate signature")
+	}
+
+	fingerprint, err := Fingerprint(request.PublicKey)
+	if err != nil {
+		return invalid(err.Error())
+	}
+	if fingerprint != post.Fingerprint {
+		return invalid("the fingerprint doesn't match the key")
+	}
+
+	// keys rotated away from or revoked here can't post here, however their posts are brought over
+	if err = pm.checkCurrentKey(fingerprint); err != nil {
+		return fmt.Errorf("post %s: %w", post.UUID, err)
+	}
+	if err = pm.blocklist.checkKey(fingerprint); err != nil {
+		return err
+	}
+	if err = pm.blocklist.checkContent(request.Title, request.Body); err != nil {
+		return err
+	}
+
+	fm, err := parseFrontMatter(request.Body)
+	if err != nil {
+		return invalid(err.Error())
+	}
+	if len(fm.Slug) > 0 {
+		if other, ok := slugs[fingerprint+"/"+fm.Slug]; ok {
+			return invalid(fmt.Sprintf("slug %s is taken by post %s", fm.Slug, other))
+		}
+		slugs[fingerprint+"/"+fm.Slug] = post.UUID
+
+		existing, err := pm.ResolveSlug(fingerprint, fm.Slug)
+		if err != nil {
+			return err
+		}
+		if len(existing) > 0 && existing != post.UUID {
+			return invalid(fmt.Sprintf("slug %s is taken by post %s", fm.Slug, existing))
+		}
+	}
+	return nil
+}
+
+// importPost creates post from request, verified by verifyArchivedPost, returning false if it was skipped
+func (pm PostManager) importPost(post model.ArchivedPost, request model.PostRequest, actor string) (bool, error) {
+	if post.ExpiresAt != nil && !post.ExpiresAt.After(time.Now()) {
+		return false, nil
+	}
+
+	if existing, err := pm.db.GetPost(post.UUID); err != nil || existing != nil {
+		return false, err
+	}
+	if dupe, err := pm.IsDuplicate(request); err != nil || dupe {
+		return false, err
+	}
+
+	fm, err := parseFrontMatter(request.Body)
+	if err != nil {
+		return false, err
+	}
+
+	imported := model.Post{
+		UUID:        post.UUID,
+		Key:         post.PublicKey,
+		Fingerprint: post.Fingerprint,
+		Signature:   post.Signature,
+		ExpiresAt:   post.ExpiresAt,
+		Status:      PostPublished,
+		PublishAt:   fm.PublishAt,
+	}
+	imported.CreatedAt = post.CreatedAt
+	if len(fm.Slug) > 0 {
+		imported.Slug = &fm.Slug
+	}
+
+	// the author signed the post, the operator imported it
+	audit := pm.newAuditEntry(AuditImportPost, actor, post.UUID, "")
+	audit.Fingerprint, audit.Signature = &post.Fingerprint, &post.Signature
+
+	renderedHTML := string(pm.renderMarkdown(request.Body))
+	if err = pm.db.PersistPost(imported, request, renderedHTML, fm.Tags, audit); err != nil {
+		return false, err
+	}
+	postsCreated.Inc()
+	return true, nil
+}
@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jtanza/post-pigeon/internal/model"
+)
+
+func testArchive(t *testing.T, files map[string]string) *bytes.Buffer {
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gz)
+	for name, data := range files {
+		if err := writeArchiveFile(tw, name, []byte(data), time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &archive
+}
+
+func TestReadArchive(t *testing.T) {
+	manifest := `{"version": 1, "fingerprint": "fp", "posts": [{"uuid": "u", "file": "./posts/u.md"}]}`
+	archive, files, err := readArchive(testArchive(t, map[string]string{
+		archiveManifest: manifest,
+		"posts/u.md":    "# hello",
+	}))
+	if err != nil {
+		t.Fatalf("could not read archive: %v", err)
+	}
+	if len(archive.Posts) != 1 || archive.Posts[0].File != "posts/u.md" {
+		t.Fatalf("expected the file of the post to be cleaned got %+v", archive.Posts)
+	}
+	if string(files[archive.Posts[0].File]) != "# hello" {
+		t.Errorf("expected the markdown of the post got %q", files[archive.Posts[0].File])
+	}
+}
+
+func TestReadArchiveInvalid(t *testing.T) {
+	tests := map[string]*bytes.Buffer{
+		"not gzipped":      bytes.NewBufferString("# hello"),
+		"missing manifest": testArchive(t, map[string]string{"posts/u.md": "# hello"}),
+		"malformed":        testArchive(t, map[string]string{archiveManifest: "{"}),
+		"unknown version":  testArchive(t, map[string]string{archiveManifest: `{"version": 2}`}),
+		"too large":        testArchive(t, map[string]string{archiveManifest: `{"version": 1}`, "big": strings.Repeat("a", maxArchiveSize)}),
+	}
+
+	for name, archive := range tests {
+		if _, _, err := readArchive(archive); !errors.Is(err, ErrInvalidArchive) {
+			t.Errorf("%s: expected an invalid archive got %v", name, err)
+		}
+	}
+}
+
+func TestImportArchiveRefusesRetiredKeys(t *testing.T) {
+	pm := newTestPostManager(t, newTestDB(t))
+	rotated, current, revoked := newTestKey(t), newTestKey(t), newTestKey(t)
+
+	statement := fmt.Sprintf("from: %s\nto: %s", rotated.fingerprint, current.fingerprint)
+	_, err := pm.RotateKey(model.RotationRequest{
+		Statement:    statement,
+		PublicKey:    rotated.publicKey,
+		Signature:    rotated.sign(t, statement),
+		NewPublicKey: current.publicKey,
+		NewSignature: current.sign(t, statement),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate := fmt.Sprintf("revoke: %s\nreason: leaked", revoked.fingerprint)
+	if _, err = pm.RevokeKey(model.RevocationRequest{Certificate: certificate, PublicKey: revoked.publicKey, Signature: revoked.sign(t, certificate)}); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, key := range map[string]testKey{"rotated": rotated, "revoked": revoked} {
+		body := "# " + name
+		manifest, err := json.Marshal(model.Archive{Version: archiveVersion, Fingerprint: key.fingerprint, Posts: []model.ArchivedPost{{
+			UUID:        uuid.NewString(),
+			Title:       name,
+			File:        "posts/post.md",
+			Fingerprint: key.fingerprint,
+			PublicKey:   key.publicKey,
+			Signature:   key.sign(t, body),
+			CreatedAt:   time.Now().UTC(),
+		}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		archive := testArchive(t, map[string]string{archiveManifest: string(manifest), "posts/post.md": body})
+		if _, err = pm.ImportArchive(archive, "operator"); !errors.Is(err, ErrRetiredKey) {
+			t.Errorf("%s: expected the posts of a retired key to be refused got %v", name, err)
+		}
+	}
+}
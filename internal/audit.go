@@ -0,0 +1,208 @@
+package internal
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/jtanza/post-pigeon/internal/model"
+	"github.com/labstack/echo/v4"
+)
+
+// The actions recorded in the audit log
+const (
+	AuditCreatePost     = "post.create"
+	AuditImportPost     = "post.import"
+	AuditPublishPost    = "post.publish"
+	AuditDeletePost     = "post.delete"
+	AuditExpirePost     = "post.expire"
+	AuditExpireDraft    = "draft.expire"
+	AuditReportPost     = "post.report"
+	AuditTakedown       = "post.takedown"
+	AuditRestore        = "post.restore"
+	AuditDismissReport  = "report.dismiss"
+	AuditRegisterHandle = "handle.register"
+	AuditClaimDomain    = "domain.claim"
+	AuditUpdateProfile  = "profile.update"
+	AuditRotateKey      = "key.rotate"
+	AuditRevokeKey      = "key.revoke"
+	AuditBlock          = "blocklist.add"
+	AuditUnblock        = "blocklist.remove"
+	AuditPurgeCache     = "cache.purge"
+	AuditRunJob         = "job.run"
+)
+
+const (
+	// actorSystem takes the actions the instance takes by itself, e.g. reaping expired posts
+	actorSystem = "system"
+	// actorReader takes the actions anyone can take without a key, e.g. reporting a post
+	actorReader = "reader"
+
+	// auditKeyFile is where the key ips are hashed with is kept, unless POST_PIGEON_AUDIT_KEY is set
+	auditKeyFile = "audit.key"
+
+	defaultAuditRetention = 365 * 24 * time.Hour
+	defaultAuditLimit     = 100
+)
+
+type auditSourceKey struct{}
+
+// auditSource is where the request an action is taken on behalf of comes from, as far as the audit log is concerned
+type auditSource struct {
+	ipHash string
+	// fingerprint and signature are those of the operator that signed an admin request, if any
+	fingerprint string
+	signature   string
+}
+
+// auditMiddleware carries the hash of the ip of every request in its context, for the audit log to record. Ips are
+// hashed with a key, see auditKey, so that they can be told apart without being stored. Ips are told by IPExtractor,
+// so that clients can't choose the ip recorded by forwarding headers of their own
+func auditMiddleware() echo.MiddlewareFunc {
+	key, err := auditKey()
+	if err != nil {
+		Fatal("could not load the audit key", "error", err)
+	}
+	extractIP := IPExtractor()
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			mac := hmac.New(sha256.New, key)
+			mac.Write([]byte(extractIP(c.Request())))
+			source := auditSource{ipHash: hex.EncodeToString(mac.Sum(nil))}
+
+			c.SetRequest(c.Request().WithContext(context.WithValue(c.Request().Context(), auditSourceKey{}, source)))
+			return next(c)
+		}
+	}
+}
+
+// auditKey returns the key ips are hashed with, configured through POST_PIGEON_AUDIT_KEY. Unless set, a random key
+// is generated on first start and kept in audit.key, alongside the db, so that hashes can be told apart across
+// restarts. Anyone holding the key can tell whether an entry came from a given ip, it mustn't be guessable
+func auditKey() ([]byte, error) {
+	if key := os.Getenv("POST_PIGEON_AUDIT_KEY"); len(key) > 0 {
+		return []byte(key), nil
+	}
+
+	key, err := os.ReadFile(auditKeyFile)
+	if err == nil {
+		if len(key) == 0 {
+			return nil, fmt.Errorf("%s is empty", auditKeyFile)
+		}
+		return key, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	key = make([]byte, 32)
+	if _, err = rand.Read(key); err != nil {
+		return nil, err
+	}
+	key = []byte(hex.EncodeToString(key))
+
+	// created exclusively so that instances starting together don't each go on with a key of their own
+	file, err := os.OpenFile(auditKeyFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if errors.Is(err, os.ErrExist) {
+		return auditKey()
+	} else if err != nil {
+		return nil, err
+	}
+	if _, err = file.Write(key); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err = file.Close(); err != nil {
+		return nil, err
+	}
+	slog.Info("generated an audit key", "file", auditKeyFile)
+	return key, nil
+}
+
+// withOperatorSignature returns a copy of ctx recording that its request was signed by the operator with
+// fingerprint, with signature
+func withOperatorSignature(ctx context.Context, fingerprint, signature string) context.Context {
+	source, _ := ctx.Value(auditSourceKey{}).(auditSource)
+	source.fingerprint, source.signature = fingerprint, signature
+	return context.WithValue(ctx, auditSourceKey{}, source)
+}
+
+// newAuditEntry returns an entry recording action taken by actor, along with where the request it was taken on
+// behalf of came from and, for admin requests, the signature of the operator
+func (pm PostManager) newAuditEntry(action, actor, postUUID, details string) model.AuditEntry {
+	entry := model.AuditEntry{Action: action, Actor: actor, Details: details}
+	if len(postUUID) > 0 {
+		entry.PostUUID = &postUUID
+	}
+
+	source, _ := pm.ctx.Value(auditSourceKey{}).(auditSource)
+	if len(source.ipHash) > 0 {
+		entry.IPHash = &source.ipHash
+	}
+	if len(source.fingerprint) > 0 {
+		entry.Fingerprint, entry.Signature = &source.fingerprint, &source.signature
+	}
+	return entry
+}
+
+// newSignedAuditEntry returns an entry recording action taken by the author with fingerprint, authorised by
+// signature
+func (pm PostManager) newSignedAuditEntry(action, fingerprint, signature, postUUID, details string) model.AuditEntry {
+	entry := pm.newAuditEntry(action, fingerprint, postUUID, details)
+	entry.Fingerprint, entry.Signature = &fingerprint, &signature
+	return entry
+}
+
+// Audit records action taken by actor in the audit log, for the actions that aren't recorded along with what they
+// change
+func (pm PostManager) Audit(action, actor, postUUID, details string) error {
+	return pm.db.PersistAuditEntry(pm.newAuditEntry(action, actor, postUUID, details))
+}
+
+// audit records entry in the audit log once what it records has taken place. Failing to is logged rather than
+// returned, as the action can't be undone by then
+func (pm PostManager) audit(entry model.AuditEntry) {
+	if err := pm.db.PersistAuditEntry(entry); err != nil {
+		slog.ErrorContext(pm.ctx, "could not record audit entry", "action", entry.Action, "error", err)
+	}
+}
+
+// FetchAuditLog returns the entries of the audit log matching query, the latest first
+func (pm PostManager) FetchAuditLog(query model.AuditQuery) ([]model.AuditEntry, error) {
+	if query.Limit == 0 {
+		query.Limit = defaultAuditLimit
+	}
+	return pm.db.GetAuditEntries(query)
+}
+
+// AuditRetention is how long entries are kept in the audit log, configured through POST_PIGEON_AUDIT_RETENTION as
+// a duration, e.g. 2160h. 0 keeps them forever
+func AuditRetention() time.Duration {
+	raw := os.Getenv("POST_PIGEON_AUDIT_RETENTION")
+	if len(raw) == 0 {
+		return defaultAuditRetention
+	}
+
+	retention, err := time.ParseDuration(raw)
+	if err != nil || retention < 0 {
+		slog.Warn("invalid POST_PIGEON_AUDIT_RETENTION, keeping entries for the default", "value", raw, "default", defaultAuditRetention)
+		return defaultAuditRetention
+	}
+	return retention
+}
+
+// PruneAuditLog drops the entries of the audit log older than AuditRetention
+func (pm PostManager) PruneAuditLog() (int64, error) {
+	retention := AuditRetention()
+	if retention == 0 {
+		return 0, nil
+	}
+	return pm.db.DeleteAuditEntries(time.Now().UTC().Add(-retention))
+}
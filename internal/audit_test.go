@@ -0,0 +1,147 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jtanza/post-pigeon/internal/model"
+	"github.com/labstack/echo/v4"
+)
+
+func TestAuditRetention(t *testing.T) {
+	t.Setenv("POST_PIGEON_AUDIT_RETENTION", "720h")
+	if retention := AuditRetention(); retention != 30*24*time.Hour {
+		t.Errorf("expected a retention of 720h got %s", retention)
+	}
+
+	t.Setenv("POST_PIGEON_AUDIT_RETENTION", "0")
+	if retention := AuditRetention(); retention != 0 {
+		t.Errorf("expected a retention of 0 to keep entries forever, got %s", retention)
+	}
+
+	t.Setenv("POST_PIGEON_AUDIT_RETENTION", "forever")
+	if retention := AuditRetention(); retention != defaultAuditRetention {
+		t.Errorf("expected invalid retentions to fall back to the default, got %s", retention)
+	}
+}
+
+func TestAuditSource(t *testing.T) {
+	t.Setenv("POST_PIGEON_AUDIT_KEY", "secret")
+
+	var pm PostManager
+	handler := auditMiddleware()(func(c echo.Context) error {
+		pm = PostManager{ctx: c.Request().Context()}
+		return nil
+	})
+
+	request := httptest.NewRequest(http.MethodPost, "/posts", nil)
+	request.RemoteAddr = "203.0.113.7:1234"
+	if err := handler(echo.New().NewContext(request, httptest.NewRecorder())); err != nil {
+		t.Fatal(err)
+	}
+
+	entry := pm.newSignedAuditEntry(AuditCreatePost, "fp=", "sig", "uuid", "")
+	if entry.IPHash == nil || len(*entry.IPHash) != 64 || *entry.IPHash == "203.0.113.7" {
+		t.Errorf("expected the ip of the request to be recorded hashed, got %v", entry.IPHash)
+	}
+	if *entry.Fingerprint != "fp=" || *entry.Signature != "sig" || *entry.PostUUID != "uuid" || entry.Actor != "fp=" {
+		t.Errorf("expected the entry to record the author and signature of the request, got %+v", entry)
+	}
+
+	pm.ctx = withOperatorSignature(pm.ctx, "operator=", "operator-sig")
+	entry = pm.newAuditEntry(AuditTakedown, "operator=", "uuid", "spam")
+	if entry.Fingerprint == nil || *entry.Fingerprint != "operator=" || *entry.Signature != "operator-sig" || entry.IPHash == nil {
+		t.Errorf("expected the entry to record the operator and signature of the request, got %+v", entry)
+	}
+}
+
+func TestAuditSourceGoesByTrustedIPs(t *testing.T) {
+	t.Setenv("POST_PIGEON_AUDIT_KEY", "secret")
+
+	ipHash := func(remoteAddr, forwardedFor string) string {
+		var source auditSource
+		handler := auditMiddleware()(func(c echo.Context) error {
+			source, _ = c.Request().Context().Value(auditSourceKey{}).(auditSource)
+			return nil
+		})
+
+		request := httptest.NewRequest(http.MethodPost, "/posts", nil)
+		request.RemoteAddr = remoteAddr
+		if len(forwardedFor) > 0 {
+			request.Header.Set(echo.HeaderXForwardedFor, forwardedFor)
+		}
+		if err := handler(echo.New().NewContext(request, httptest.NewRecorder())); err != nil {
+			t.Fatal(err)
+		}
+		return source.ipHash
+	}
+
+	direct := ipHash("203.0.113.7:1234", "")
+	if spoofed := ipHash("203.0.113.7:1234", "198.51.100.1"); spoofed != direct {
+		t.Error("expected a forwarded ip that isn't trusted not to change the ip recorded")
+	}
+
+	t.Setenv("POST_PIGEON_TRUSTED_PROXIES", "203.0.113.7")
+	if forwarded := ipHash("203.0.113.7:1234", "198.51.100.1"); forwarded != ipHash("198.51.100.1:1234", "") {
+		t.Error("expected the ip forwarded by a trusted proxy to be recorded")
+	}
+}
+
+func TestAuditKey(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	t.Setenv("POST_PIGEON_AUDIT_KEY", "secret")
+	if key, err := auditKey(); err != nil || string(key) != "secret" {
+		t.Errorf("expected the configured audit key got %q: %v", key, err)
+	}
+
+	t.Setenv("POST_PIGEON_AUDIT_KEY", "")
+	t.Setenv("POST_PIGEON_NS", "post-pigeon-test")
+	generated, err := auditKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(generated) == 0 || string(generated) == "post-pigeon-test" {
+		t.Errorf("expected a random audit key to be generated got %q", generated)
+	}
+	if info, err := os.Stat(auditKeyFile); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("expected the generated key to be kept private in %s: %v", auditKeyFile, err)
+	}
+	if kept, err := auditKey(); err != nil || string(kept) != string(generated) {
+		t.Errorf("expected the generated key to be kept across restarts got %q: %v", kept, err)
+	}
+}
+
+func TestScheduledPostsAudited(t *testing.T) {
+	db := newTestDB(t)
+	pm := newTestPostManager(t, db)
+	post := createTestPost(t, pm, newTestKey(t), "scheduled", "---\npublish_at: 2100-01-01T00:00:00Z\n---\n# scheduled")
+	if post.Status != PostScheduled {
+		t.Fatalf("expected the post to be scheduled got %s", post.Status)
+	}
+	if err := db.db.Model(&model.Post{}).Where("uuid = ?", post.UUID).Update("publish_at", time.Now().UTC().Add(-time.Minute)).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ScheduledPostsJob(db).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := pm.FetchAuditLog(model.AuditQuery{Action: AuditPublishPost, PostUUID: post.UUID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Actor != actorSystem {
+		t.Errorf("expected the instance publishing the post to be recorded got %+v", entries)
+	}
+}
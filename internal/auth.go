@@ -5,38 +5,135 @@ import (
 	"crypto/sha1"
 	"crypto/sha256"
 	"crypto/x509"
+	"encoding/asn1"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/pem"
 	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/jtanza/post-pigeon/internal/model"
+)
+
+// ecdsaSignature is the ASN.1 structure of the signatures produced by `openssl dgst -sign`
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// SignatureAlgorithm describes the scheme ValidateSignature verifies signatures against
+const SignatureAlgorithm = "ECDSA-SHA1"
+
+// The reasons ValidateSignature fails for
+var (
+	ErrInvalidKey         = errors.New("invalid public key")
+	ErrMalformedSignature = errors.New("malformed signature")
+	ErrInvalidSignature   = errors.New("invalid signature")
 )
 
 // ValidateSignature ensures that the signature provided in base64EncodedSignature is valid, i.e.
 // it was signed by the provided rawPubKey and contains the provided message
 func ValidateSignature(rawPubKey string, base64EncodedSignature string, message string) error {
-	block, _ := pem.Decode([]byte(rawPubKey))
-	if block == nil {
-		return errors.New("invalid PEM block")
+	err := validateSignature(rawPubKey, base64EncodedSignature, message)
+	if err != nil {
+		signatureFailures.WithLabelValues(signatureFailureReason(err)).Inc()
 	}
+	return err
+}
 
-	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+func validateSignature(rawPubKey string, base64EncodedSignature string, message string) error {
+	pubKey, err := parsePublicKey(rawPubKey)
 	if err != nil {
 		return err
 	}
-	pubKey := key.(*ecdsa.PublicKey)
 
 	signature, err := base64.StdEncoding.DecodeString(base64EncodedSignature)
 	if err != nil {
-		return err
+		return fmt.Errorf("%w: %v", ErrMalformedSignature, err)
 	}
 
 	hash := sha1.Sum([]byte(message))
 	if !ecdsa.VerifyASN1(pubKey, hash[:], signature) {
-		return errors.New("invalid signature")
+		return ErrInvalidSignature
 	}
 
 	return nil
 }
 
+// signatureFailureReason labels the failures of ValidateSignature
+func signatureFailureReason(err error) string {
+	switch {
+	case errors.Is(err, ErrInvalidKey):
+		return "invalid_key"
+	case errors.Is(err, ErrMalformedSignature):
+		return "malformed_signature"
+	case errors.Is(err, ErrInvalidSignature):
+		return "mismatch"
+	default:
+		return "unknown"
+	}
+}
+
+// VerifySignature runs the provided request through ValidateSignature, describing the outcome
+// along with the details of the key and message needed to reproduce it
+func VerifySignature(request model.VerifyRequest) model.SignatureVerification {
+	verification := model.SignatureVerification{
+		PublicKey:   request.PublicKey,
+		Signature:   request.Signature,
+		Algorithm:   SignatureAlgorithm,
+		MessageHash: MessageHash(request.Message),
+	}
+
+	if fingerprint, err := Fingerprint(request.PublicKey); err == nil {
+		verification.Fingerprint = fingerprint
+	}
+	if curve, err := KeyCurve(request.PublicKey); err == nil {
+		verification.Curve = curve
+	}
+
+	if err := ValidateSignature(request.PublicKey, request.Signature, request.Message); err != nil {
+		verification.Error = err.Error()
+	} else {
+		verification.Valid = true
+	}
+
+	return verification
+}
+
+// MessageHash returns the hex encoded digest of message that signatures are made over
+func MessageHash(message string) string {
+	hash := sha1.Sum([]byte(message))
+	return hex.EncodeToString(hash[:])
+}
+
+// KeyCurve returns the name of the elliptic curve rawPubKey is a point on, e.g. P-521
+func KeyCurve(rawPubKey string) (string, error) {
+	pubKey, err := parsePublicKey(rawPubKey)
+	if err != nil {
+		return "", err
+	}
+	return pubKey.Curve.Params().Name, nil
+}
+
+func parsePublicKey(rawPubKey string) (*ecdsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(rawPubKey))
+	if block == nil {
+		return nil, fmt.Errorf("%w: invalid PEM block", ErrInvalidKey)
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+
+	pubKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: public key is not an ECDSA key", ErrInvalidKey)
+	}
+
+	return pubKey, nil
+}
+
 // Fingerprint will attempt to generate a fingerprint from the provided rawPubKey
 // The fingerprint is simply the URL safe, Base64 encoded sha256 hash of the public key
 func Fingerprint(rawPubKey string) (string, error) {
@@ -50,3 +147,37 @@ func Fingerprint(rawPubKey string) (string, error) {
 
 	return base64.URLEncoding.EncodeToString(s.Sum(nil)), nil
 }
+
+// IsReplayedSignature reports whether signature shares its nonce with original. Fresh signatures are
+// always made with a new random nonce, so a match means signature is a copy of original (or a trivially
+// malleated form of it, as (r, s) and (r, -s) both verify) rather than proof of holding the private key
+func IsReplayedSignature(signature, original string) bool {
+	r, err := signatureNonce(signature)
+	if err != nil {
+		return false
+	}
+
+	originalR, err := signatureNonce(original)
+	if err != nil {
+		return false
+	}
+
+	return r.Cmp(originalR) == 0
+}
+
+func signatureNonce(base64EncodedSignature string) (*big.Int, error) {
+	der, err := base64.StdEncoding.DecodeString(base64EncodedSignature)
+	if err != nil {
+		return nil, err
+	}
+
+	var sig ecdsaSignature
+	if _, err = asn1.Unmarshal(der, &sig); err != nil {
+		return nil, err
+	}
+	if sig.R == nil {
+		return nil, errors.New("invalid signature")
+	}
+
+	return sig.R, nil
+}
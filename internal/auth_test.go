@@ -1,7 +1,9 @@
 package internal_test
 
 import (
+	"errors"
 	"github.com/jtanza/post-pigeon/internal"
+	"github.com/jtanza/post-pigeon/internal/model"
 	"testing"
 )
 
@@ -68,3 +70,55 @@ func TestFingerprintInvalid(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestIsReplayedSignature(t *testing.T) {
+	if !internal.IsReplayedSignature(base64Signature, base64Signature) {
+		t.Error("identical signatures should be detected as replayed")
+	}
+
+	fresh := "MIGIAkIB9Ll8gnRfPl6Z/FQnfRGcLAMeHbI9bbk6EZKUpnex9MxVczKVLiLNRR6cjzc0Rs4L9YSnRBP0E2N7CuOq8V+zWysCQgDhUtDTVBed2AnydbK4Qm+eY54EpjzRfTkUB9ksJ8slUdCHDXaJcWCLriqRZH5Dq2yfLHt6nlkfUv+R4YiBFzXyEQ=="
+	if internal.IsReplayedSignature(fresh, base64Signature) {
+		t.Error("signatures made with different nonces should not be detected as replayed")
+	}
+
+	if internal.IsReplayedSignature(base64Signature, "") {
+		t.Error("missing signatures should never match")
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	verification := internal.VerifySignature(model.VerifyRequest{PublicKey: pubKey, Signature: base64Signature, Message: plaintextMessage})
+	if !verification.Valid {
+		t.Errorf("expected valid signature, got error %s", verification.Error)
+	}
+	if verification.Curve != "P-521" {
+		t.Errorf("expected curve P-521 got %s", verification.Curve)
+	}
+	if verification.MessageHash != "c65f99f8c5376adadddc46d5cbcf5762f9e55eb7" {
+		t.Errorf("unexpected message hash %s", verification.MessageHash)
+	}
+
+	verification = internal.VerifySignature(model.VerifyRequest{PublicKey: pubKey, Signature: base64Signature, Message: "GOODBYE"})
+	if verification.Valid || len(verification.Error) == 0 {
+		t.Error("expected invalid signature to be reported")
+	}
+}
+
+func TestValidateSignatureFailsNonECDSAKey(t *testing.T) {
+	rsaKey := "-----BEGIN PUBLIC KEY-----\nMFwwDQYJKoZIhvcNAQEBBQADSwAwSAJBALV7AfeGvN9f58D59sceuNYJ/xPGfANx\nir2g5ht/2ZBvrPCc/pSKFxgRR0BKSAnpvbk/nuiyS/y8DR92/+1WAcUCAwEAAQ==\n-----END PUBLIC KEY-----"
+	if err := internal.ValidateSignature(rsaKey, base64Signature, plaintextMessage); err == nil {
+		t.Error("expected non ECDSA keys to be rejected")
+	}
+}
+
+func TestValidateSignatureFailureReasons(t *testing.T) {
+	if err := internal.ValidateSignature(pubKey[5:], base64Signature, plaintextMessage); !errors.Is(err, internal.ErrInvalidKey) {
+		t.Errorf("expected invalid key error, got %v", err)
+	}
+	if err := internal.ValidateSignature(pubKey, "!!!", plaintextMessage); !errors.Is(err, internal.ErrMalformedSignature) {
+		t.Errorf("expected malformed signature error, got %v", err)
+	}
+	if err := internal.ValidateSignature(pubKey, base64Signature, "GOODBYE"); !errors.Is(err, internal.ErrInvalidSignature) {
+		t.Errorf("expected invalid signature error, got %v", err)
+	}
+}
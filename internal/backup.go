@@ -0,0 +1,220 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jtanza/post-pigeon/internal/model"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+const (
+	// DBFile is the sqlite file everything is stored in
+	DBFile = "postpigeon.db"
+
+	defaultBackupDir  = "backups"
+	defaultBackupKeep = 7
+
+	backupPrefix     = "postpigeon-"
+	backupSuffix     = ".db"
+	backupTimeFormat = "20060102T150405Z"
+)
+
+// ErrInvalidBackup is returned when a backup is corrupt, or can't be restored over the db
+var ErrInvalidBackup = errors.New("invalid backup")
+
+// BackupDir is where backups are written, configured through POST_PIGEON_BACKUP_DIR and defaulting to ./backups
+func BackupDir() string {
+	if dir := os.Getenv("POST_PIGEON_BACKUP_DIR"); len(dir) > 0 {
+		return dir
+	}
+	return defaultBackupDir
+}
+
+// BackupKeep is how many backups are kept in BackupDir, the oldest being dropped as new ones are made, configured
+// through POST_PIGEON_BACKUP_KEEP. 0 keeps them all
+func BackupKeep() int {
+	raw := os.Getenv("POST_PIGEON_BACKUP_KEEP")
+	if len(raw) == 0 {
+		return defaultBackupKeep
+	}
+
+	keep, err := strconv.Atoi(raw)
+	if err != nil || keep < 0 {
+		slog.Warn("invalid POST_PIGEON_BACKUP_KEEP, keeping the default", "value", raw, "default", defaultBackupKeep)
+		return defaultBackupKeep
+	}
+	return keep
+}
+
+// VacuumInto writes a consistent copy of the db to path, which mustn't exist yet, without blocking writers for
+// longer than it takes to read it
+func (d DB) VacuumInto(path string) error {
+	return d.db.Exec("vacuum into ?", path).Error
+}
+
+// Backup writes a copy of db to dir, named after when it was made, and checks its integrity before dropping all
+// but the keep latest backups in dir. Returns the path of the backup
+func Backup(ctx context.Context, db DB, dir string, keep int) (string, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, backupPrefix+time.Now().UTC().Format(backupTimeFormat)+backupSuffix)
+	if err := db.WithContext(ctx).VacuumInto(path); err != nil {
+		return "", fmt.Errorf("could not back up the db: %w", err)
+	}
+	if _, err := CheckBackup(path); err != nil {
+		if removeErr := os.Remove(path); removeErr != nil {
+			slog.ErrorContext(ctx, "could not remove failed backup", "path", path, "error", removeErr)
+		}
+		return "", err
+	}
+
+	if err := pruneBackups(dir, keep); err != nil {
+		return path, fmt.Errorf("backed up to %s but could not drop old backups: %w", path, err)
+	}
+	return path, nil
+}
+
+// CheckBackup ensures the db at path is intact, returning the version its schema is at
+func CheckBackup(path string) (int, error) {
+	if _, err := os.Stat(path); err != nil {
+		return 0, err
+	}
+
+	conn, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=ro", path)), &gorm.Config{
+		Logger: gormlogger.Discard,
+	})
+	if err != nil {
+		return 0, err
+	}
+	sqlDB, err := conn.DB()
+	if err != nil {
+		return 0, err
+	}
+	defer sqlDB.Close()
+
+	var problems []string
+	if checkQuery := conn.Raw("pragma integrity_check").Scan(&problems); checkQuery.Error != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidBackup, checkQuery.Error)
+	}
+	if len(problems) != 1 || problems[0] != "ok" {
+		return 0, fmt.Errorf("%w: integrity check failed: %s", ErrInvalidBackup, strings.Join(problems, "; "))
+	}
+
+	version, err := DB{conn}.SchemaVersion()
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidBackup, err)
+	}
+	return version, nil
+}
+
+// ListBackups returns the backups in dir, the latest first
+func ListBackups(dir string) ([]model.Backup, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, backupPrefix+"*"+backupSuffix))
+	if err != nil {
+		return nil, err
+	}
+	// backups are named after when they were made, so that they sort by it
+	sort.Sort(sort.Reverse(sort.StringSlice(paths)))
+
+	backups := make([]model.Backup, 0, len(paths))
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, model.Backup{Name: filepath.Base(path), Size: info.Size(), CreatedAt: info.ModTime().UTC()})
+	}
+	return backups, nil
+}
+
+// pruneBackups drops all but the keep latest backups in dir, keeping them all when keep is 0
+func pruneBackups(dir string, keep int) error {
+	if keep == 0 {
+		return nil
+	}
+
+	backups, err := ListBackups(dir)
+	if err != nil {
+		return err
+	}
+	for _, backup := range backups[min(keep, len(backups)):] {
+		if err = os.Remove(filepath.Join(dir, backup.Name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restore replaces the db at target with the backup at path, once it's checked to be intact and at the version of
+// the latest migration. The db it replaces is kept alongside it, suffixed with when it was replaced, and is
+// returned. The app must not be running while it's restored
+func Restore(path, target string) (string, error) {
+	version, err := CheckBackup(path)
+	if err != nil {
+		return "", err
+	}
+	latest, err := latestMigration()
+	if err != nil {
+		return "", err
+	}
+	if version != latest {
+		return "", fmt.Errorf("%w: schema at version %d, latest migration is %d", ErrInvalidBackup, version, latest)
+	}
+
+	// copied next to target first, so that it's swapped in by a rename that either happens whole or not at all
+	restoring := target + ".restoring"
+	if err = copyFile(path, restoring); err != nil {
+		return "", err
+	}
+
+	replaced := ""
+	if _, err = os.Stat(target); err == nil {
+		replaced = fmt.Sprintf("%s.%s", target, time.Now().UTC().Format(backupTimeFormat))
+		// the journals of the db replaced go along with it, lest they be replayed onto the backup
+		for _, suffix := range []string{"", "-wal", "-shm", "-journal"} {
+			if err = os.Rename(target+suffix, replaced+suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return "", err
+			}
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	return replaced, os.Rename(restoring, target)
+}
+
+func copyFile(from, to string) error {
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o640)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err = dst.Sync(); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
@@ -0,0 +1,127 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// testDB opens a db at path, its schema at version
+func testDB(t *testing.T, path string, version int) DB {
+	conn, err := gorm.Open(sqlite.Open("file:"+path), &gorm.Config{Logger: gormlogger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := conn.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err = conn.Exec("create table post (id integer primary key, title text)").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.Exec("insert into post (title) values ('hello')").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.Exec(fmt.Sprintf("pragma user_version = %d", version)).Error; err != nil {
+		t.Fatal(err)
+	}
+	return DB{conn}
+}
+
+func TestBackup(t *testing.T) {
+	dir := t.TempDir()
+	db := testDB(t, filepath.Join(dir, DBFile), 2)
+
+	path, err := Backup(context.Background(), db, filepath.Join(dir, "backups"), 1)
+	if err != nil {
+		t.Fatalf("could not back up: %v", err)
+	}
+	version, err := CheckBackup(path)
+	if err != nil {
+		t.Fatalf("could not check backup: %v", err)
+	}
+	if version != 2 {
+		t.Errorf("expected the backup to keep the schema version 2 got %d", version)
+	}
+}
+
+func TestCheckBackupCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "postpigeon-corrupt.db")
+	if err := os.WriteFile(path, []byte("not a db"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CheckBackup(path); err == nil {
+		t.Error("expected a corrupt backup to fail its check")
+	}
+}
+
+func TestPruneBackups(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{"postpigeon-20240101T000000Z.db", "postpigeon-20240102T000000Z.db", "postpigeon-20240103T000000Z.db", "other.db"}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := pruneBackups(dir, 2); err != nil {
+		t.Fatal(err)
+	}
+	backups, err := ListBackups(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 || backups[0].Name != names[2] || backups[1].Name != names[1] {
+		t.Errorf("expected the 2 latest backups to be kept got %+v", backups)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "other.db")); err != nil {
+		t.Errorf("expected files other than backups to be left alone: %v", err)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	latest, err := latestMigration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	outdated := filepath.Join(dir, "outdated.db")
+	testDB(t, outdated, latest-1)
+	if _, err = Restore(outdated, DBFile); !errors.Is(err, ErrInvalidBackup) {
+		t.Errorf("expected a backup at an older schema version to be refused got %v", err)
+	}
+
+	current := filepath.Join(dir, "current.db")
+	testDB(t, current, latest)
+	if err = os.WriteFile(DBFile, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	replaced, err := Restore(current, DBFile)
+	if err != nil {
+		t.Fatalf("could not restore: %v", err)
+	}
+	if old, err := os.ReadFile(replaced); err != nil || string(old) != "old" {
+		t.Errorf("expected the replaced db to be kept at %s", replaced)
+	}
+	if version, err := CheckBackup(DBFile); err != nil || version != latest {
+		t.Errorf("expected the backup to be restored got version %d: %v", version, err)
+	}
+}
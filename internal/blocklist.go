@@ -0,0 +1,255 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/jtanza/post-pigeon/internal/model"
+)
+
+// The kinds of things that can be blocklisted
+const (
+	// BlockFingerprint bars a key from posting
+	BlockFingerprint = "fingerprint"
+	// BlockHash bars a body, by the hex encoded sha256 of the file it's uploaded as
+	BlockHash = "hash"
+	// BlockKeyword bars posts whose title or body contains a word or phrase, regardless of case
+	BlockKeyword = "keyword"
+	// BlockPattern bars posts whose title or body matches a regular expression
+	BlockPattern = "pattern"
+)
+
+// ErrBannedKey is returned when a banned key tries to post
+var ErrBannedKey = errors.New("banned key")
+
+// ErrBlockedContent is returned when a post is barred by the blocklist for what it says
+var ErrBlockedContent = errors.New("blocked content")
+
+// ErrNotBlocklisted is returned when lifting a blocklist entry, or a ban, that doesn't exist
+var ErrNotBlocklisted = errors.New("not blocklisted")
+
+// ErrInvalidBlocklistEntry is returned when adding something to the blocklist that couldn't ever match
+var ErrInvalidBlocklistEntry = errors.New("invalid blocklist entry")
+
+// Blocklist keeps the blocklist in memory, so that posts can be checked against it without going to the db. It's
+// loaded on first use and reloaded whenever it's changed through this instance, as well as by BlocklistJob to
+// pick up changes made through others
+type Blocklist struct {
+	db    DB
+	rules atomic.Pointer[blocklistRules]
+	// mu keeps reloads from racing, so that an older read of the db never replaces a newer one
+	mu sync.Mutex
+}
+
+type blocklistRules struct {
+	fingerprints map[string]bool
+	hashes       map[string]bool
+	keywords     []string
+	patterns     []*regexp.Regexp
+}
+
+func NewBlocklist(db DB) *Blocklist {
+	return &Blocklist{db: db}
+}
+
+// Reload reads the blocklist anew from the db, returning how many entries it holds
+func (b *Blocklist) Reload() (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	entries, err := b.db.GetBlocklist()
+	if err != nil {
+		return 0, err
+	}
+
+	rules := &blocklistRules{fingerprints: map[string]bool{}, hashes: map[string]bool{}}
+	for _, entry := range entries {
+		switch entry.Kind {
+		case BlockFingerprint:
+			rules.fingerprints[entry.Value] = true
+		case BlockHash:
+			rules.hashes[entry.Value] = true
+		case BlockKeyword:
+			rules.keywords = append(rules.keywords, entry.Value)
+		case BlockPattern:
+			pattern, err := regexp.Compile(entry.Value)
+			if err != nil {
+				// patterns are checked before they're stored, this only happens to those added by hand
+				slog.Warn("skipping invalid blocklist pattern", "id", entry.ID, "pattern", entry.Value, "error", err)
+				continue
+			}
+			rules.patterns = append(rules.patterns, pattern)
+		}
+	}
+
+	b.rules.Store(rules)
+	return len(entries), nil
+}
+
+// current returns the rules in effect, loading them if they haven't been yet
+func (b *Blocklist) current() (*blocklistRules, error) {
+	if rules := b.rules.Load(); rules != nil {
+		return rules, nil
+	}
+	if _, err := b.Reload(); err != nil {
+		return nil, err
+	}
+	return b.rules.Load(), nil
+}
+
+// checkKey ensures the key with fingerprint isn't banned
+func (b *Blocklist) checkKey(fingerprint string) error {
+	rules, err := b.current()
+	if err != nil {
+		return err
+	}
+	if rules.fingerprints[fingerprint] {
+		postsBlocked.WithLabelValues(BlockFingerprint).Inc()
+		return fmt.Errorf("%w: this key has been banned from posting", ErrBannedKey)
+	}
+	return nil
+}
+
+// checkContent ensures neither the title of a post nor its body, as uploaded, are blocklisted. Which entry a post
+// is barred by is kept from its author, so as not to help them work around it
+func (b *Blocklist) checkContent(title, body string) error {
+	rules, err := b.current()
+	if err != nil {
+		return err
+	}
+
+	if rules.hashes[hashBody(body)] {
+		postsBlocked.WithLabelValues(BlockHash).Inc()
+		return fmt.Errorf("%w: this file can't be posted here", ErrBlockedContent)
+	}
+
+	lowerTitle, lowerBody := strings.ToLower(title), strings.ToLower(body)
+	for _, keyword := range rules.keywords {
+		if strings.Contains(lowerTitle, keyword) || strings.Contains(lowerBody, keyword) {
+			postsBlocked.WithLabelValues(BlockKeyword).Inc()
+			return fmt.Errorf("%w: this post contains content that can't be posted here", ErrBlockedContent)
+		}
+	}
+	for _, pattern := range rules.patterns {
+		if pattern.MatchString(title) || pattern.MatchString(body) {
+			postsBlocked.WithLabelValues(BlockPattern).Inc()
+			return fmt.Errorf("%w: this post contains content that can't be posted here", ErrBlockedContent)
+		}
+	}
+	return nil
+}
+
+// hashBody returns the hex encoded sha256 of body, which bodies are blocklisted by
+func hashBody(body string) string {
+	hash := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(hash[:])
+}
+
+// normaliseBlocklistEntry returns value as it's stored in the blocklist as kind, ensuring it can be matched
+func normaliseBlocklistEntry(kind, value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if len(value) == 0 {
+		return "", fmt.Errorf("%w: empty value", ErrInvalidBlocklistEntry)
+	}
+
+	switch kind {
+	case BlockFingerprint:
+		return value, nil
+	case BlockHash:
+		value = strings.ToLower(value)
+		if decoded, err := hex.DecodeString(value); err != nil || len(decoded) != sha256.Size {
+			return "", fmt.Errorf("%w: hashes must be hex encoded sha256", ErrInvalidBlocklistEntry)
+		}
+		return value, nil
+	case BlockKeyword:
+		return strings.ToLower(value), nil
+	case BlockPattern:
+		if _, err := regexp.Compile(value); err != nil {
+			return "", fmt.Errorf("%w: %v", ErrInvalidBlocklistEntry, err)
+		}
+		return value, nil
+	default:
+		return "", fmt.Errorf("%w: unknown kind %s", ErrInvalidBlocklistEntry, kind)
+	}
+}
+
+// Block adds value of kind to the blocklist, for reason, on behalf of actor. Posts already made are left as they
+// are, see TakeDownPost. Blocking something that's already blocked does nothing
+func (pm PostManager) Block(kind, value, reason, actor string) error {
+	value, err := normaliseBlocklistEntry(kind, value)
+	if err != nil {
+		return err
+	}
+
+	entry := model.BlocklistEntry{Kind: kind, Value: value, Reason: reason, CreatedBy: actor}
+	details := fmt.Sprintf("%s %s", kind, value)
+	if len(reason) > 0 {
+		details = fmt.Sprintf("%s: %s", details, reason)
+	}
+	audit := pm.newAuditEntry(AuditBlock, actor, "", details)
+	if created, err := pm.db.PersistBlocklistEntry(entry, audit); err != nil || !created {
+		return err
+	}
+
+	_, err = pm.blocklist.Reload()
+	return err
+}
+
+// Unblock lifts the blocklist entry with id, on behalf of actor
+func (pm PostManager) Unblock(id int, actor string) error {
+	entry, err := pm.db.GetBlocklistEntry(id)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return fmt.Errorf("%w: no blocklist entry %d", ErrNotBlocklisted, id)
+	}
+	return pm.unblock(entry.Kind, entry.Value, actor)
+}
+
+func (pm PostManager) unblock(kind, value, actor string) error {
+	audit := pm.newAuditEntry(AuditUnblock, actor, "", fmt.Sprintf("%s %s", kind, value))
+	if lifted, err := pm.db.DeleteBlocklistEntry(kind, value, audit); err != nil {
+		return err
+	} else if !lifted {
+		return fmt.Errorf("%w: %s", ErrNotBlocklisted, value)
+	}
+
+	_, err := pm.blocklist.Reload()
+	return err
+}
+
+// FetchBlocklist returns every blocklist entry of kind, or every entry at all without a kind, the latest first
+func (pm PostManager) FetchBlocklist(kind string) ([]model.BlocklistEntry, error) {
+	if len(kind) == 0 {
+		return pm.db.GetBlocklist()
+	}
+	return pm.db.GetBlocklistEntries(kind)
+}
+
+// BanFingerprint bars the key with fingerprint from posting, for reason, on behalf of actor
+func (pm PostManager) BanFingerprint(fingerprint, reason, actor string) error {
+	return pm.Block(BlockFingerprint, fingerprint, reason, actor)
+}
+
+// UnbanFingerprint lifts the ban of the key with fingerprint, on behalf of actor
+func (pm PostManager) UnbanFingerprint(fingerprint, actor string) error {
+	return pm.unblock(BlockFingerprint, fingerprint, actor)
+}
+
+// FetchBans returns every banned fingerprint, the latest banned first
+func (pm PostManager) FetchBans() ([]model.BlocklistEntry, error) {
+	return pm.db.GetBlocklistEntries(BlockFingerprint)
+}
+
+// ReloadBlocklist reads the blocklist anew, picking up changes made through other instances
+func (pm PostManager) ReloadBlocklist() (int, error) {
+	return pm.blocklist.Reload()
+}
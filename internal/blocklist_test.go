@@ -0,0 +1,137 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/jtanza/post-pigeon/internal/model"
+)
+
+func TestNormaliseBlocklistEntry(t *testing.T) {
+	hash := hashBody("spam")
+	tests := []struct {
+		kind     string
+		value    string
+		expected string
+		invalid  bool
+	}{
+		{BlockFingerprint, " abc= ", "abc=", false},
+		{BlockHash, strings.ToUpper(hash), hash, false},
+		{BlockHash, "abc", "", true},
+		{BlockKeyword, "Buy Now", "buy now", false},
+		{BlockPattern, `(?i)casino\s+bonus`, `(?i)casino\s+bonus`, false},
+		{BlockPattern, "(unclosed", "", true},
+		{BlockKeyword, "  ", "", true},
+		{"ip", "127.0.0.1", "", true},
+	}
+
+	for _, test := range tests {
+		value, err := normaliseBlocklistEntry(test.kind, test.value)
+		if test.invalid {
+			if !errors.Is(err, ErrInvalidBlocklistEntry) {
+				t.Errorf("expected %s %q to be invalid got %v", test.kind, test.value, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("could not normalise %s %q: %v", test.kind, test.value, err)
+		} else if value != test.expected {
+			t.Errorf("expected %s %q to be normalised to %q got %q", test.kind, test.value, test.expected, value)
+		}
+	}
+}
+
+func TestBlocklistChecks(t *testing.T) {
+	blocklist := &Blocklist{}
+	blocklist.rules.Store(&blocklistRules{
+		fingerprints: map[string]bool{"banned=": true},
+		hashes:       map[string]bool{hashBody("# known bad file\n"): true},
+		keywords:     []string{"buy now"},
+		patterns:     []*regexp.Regexp{regexp.MustCompile(`casino\s+bonus`)},
+	})
+
+	if err := blocklist.checkKey("banned="); !errors.Is(err, ErrBannedKey) {
+		t.Errorf("expected a banned key to be refused got %v", err)
+	}
+	if err := blocklist.checkKey("fine="); err != nil {
+		t.Errorf("expected a key that isn't banned to be let through got %v", err)
+	}
+
+	tests := []struct {
+		title   string
+		body    string
+		blocked bool
+	}{
+		{"hello", "# known bad file\n", true},
+		{"hello", "# known bad file\n\n", false},
+		{"BUY NOW", "# hello", true},
+		{"hello", "you should Buy Now", true},
+		{"hello", "a casino   bonus", true},
+		{"hello", "# hello", false},
+	}
+	for _, test := range tests {
+		err := blocklist.checkContent(test.title, test.body)
+		if test.blocked && !errors.Is(err, ErrBlockedContent) {
+			t.Errorf("expected %q %q to be blocked got %v", test.title, test.body, err)
+		} else if !test.blocked && err != nil {
+			t.Errorf("expected %q %q to be let through got %v", test.title, test.body, err)
+		}
+	}
+}
+
+func TestBannedKeysCantHandOverOrPublish(t *testing.T) {
+	pm := newTestPostManager(t, newTestDB(t))
+	banned, clean := newTestKey(t), newTestKey(t)
+	body := "# draft"
+	draft, err := pm.CreatePost(model.PostRequest{Title: "draft", Body: body, PublicKey: banned.publicKey, Signature: banned.sign(t, body), Draft: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = pm.Block(BlockFingerprint, banned.fingerprint, "spam", "operator"); err != nil {
+		t.Fatal(err)
+	}
+
+	rotate := func(from, to testKey) error {
+		statement := fmt.Sprintf("from: %s\nto: %s", from.fingerprint, to.fingerprint)
+		_, err := pm.RotateKey(model.RotationRequest{
+			Statement:    statement,
+			PublicKey:    from.publicKey,
+			Signature:    from.sign(t, statement),
+			NewPublicKey: to.publicKey,
+			NewSignature: to.sign(t, statement),
+		})
+		return err
+	}
+	if err = rotate(banned, clean); !errors.Is(err, ErrBannedKey) {
+		t.Errorf("expected a banned key to be refused rotating away got %v", err)
+	}
+	if err = rotate(clean, banned); !errors.Is(err, ErrBannedKey) {
+		t.Errorf("expected a banned key to be refused being rotated to got %v", err)
+	}
+
+	revoke := func(revoked, successor testKey) error {
+		certificate := fmt.Sprintf("revoke: %s\nreason: leaked\nsuccessor: %s", revoked.fingerprint, successor.fingerprint)
+		_, err := pm.RevokeKey(model.RevocationRequest{
+			Certificate:  certificate,
+			PublicKey:    revoked.publicKey,
+			Signature:    revoked.sign(t, certificate),
+			NewPublicKey: successor.publicKey,
+			NewSignature: successor.sign(t, certificate),
+		})
+		return err
+	}
+	if err = revoke(clean, banned); !errors.Is(err, ErrBannedKey) {
+		t.Errorf("expected a banned key to be refused succeeding a revoked key got %v", err)
+	}
+	if err = revoke(banned, clean); !errors.Is(err, ErrBannedKey) {
+		t.Errorf("expected a banned key to be refused handing its posts to a successor got %v", err)
+	}
+
+	signature := banned.sign(t, "publish: "+draft.UUID+"\n"+body)
+	if _, err = pm.PublishPost(model.PublishRequest{UUID: draft.UUID, Signature: signature}); !errors.Is(err, ErrBannedKey) {
+		t.Errorf("expected a banned key to be refused publishing its drafts got %v", err)
+	}
+}
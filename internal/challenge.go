@@ -0,0 +1,249 @@
+package internal
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/bits"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jtanza/post-pigeon/internal/model"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// challengeTTL is how long a challenge can be solved for
+	challengeTTL = 10 * time.Minute
+	// maxDifficulty caps how hard challenges get, so that browsers can still solve them in a reasonable time
+	maxDifficulty = 24
+
+	// volumeThreshold and ipThreshold are how many posts can be created within each challengeTTL, overall and from
+	// a single ip, before challenges get harder. Each doubling over the threshold adds a bit of difficulty
+	volumeThreshold = 100
+	ipThreshold     = 10
+)
+
+// ErrInvalidProof is returned when a post doesn't come with a solution to a challenge, as Challenges require
+var ErrInvalidProof = errors.New("invalid proof of work")
+
+// Challenges issues the hashcash-style proof-of-work challenges posts are created with, to make flooding the app
+// with posts from freshly minted keys costly. A challenge is solved by finding a proof such that the sha256 of
+//
+//	{challenge}:{title}:{signature}:{proof}
+//
+// starts with at least as many zero bits as the challenge is difficult, the signature stripped of whitespace.
+// Solutions are bound to the post they're found for, any other post needs solving for anew. Challenges are signed
+// rather than stored, only remembered once solved so that each is solved for a single post, and are harder to solve
+// the more posts were recently created, overall and from the ip asking. Posts rather than challenges are counted, as
+// anyone can ask for as many challenges as they like
+type Challenges struct {
+	secret     []byte
+	difficulty int
+	store      RateLimitStore
+}
+
+// NewChallenges returns the challenges configured through the environment, counting posts created and remembering
+// solved challenges in store:
+//
+//	POST_PIGEON_POW_DIFFICULTY  zero bits challenges start out requiring, 0, the default, requires no proof at all
+//	POST_PIGEON_POW_SECRET      key challenges are signed with, shared by every instance. Random unless set
+func NewChallenges(store RateLimitStore) Challenges {
+	difficulty := 0
+	if raw := os.Getenv("POST_PIGEON_POW_DIFFICULTY"); len(raw) > 0 {
+		if d, err := strconv.Atoi(raw); err == nil && d >= 0 && d <= maxDifficulty {
+			difficulty = d
+		} else {
+			slog.Warn("invalid POST_PIGEON_POW_DIFFICULTY, requiring no proof of work", "value", raw, "max", maxDifficulty)
+		}
+	}
+
+	secret := []byte(os.Getenv("POST_PIGEON_POW_SECRET"))
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			Fatal("could not generate proof of work secret", "error", err)
+		}
+		if difficulty > 0 {
+			slog.Warn("unset POST_PIGEON_POW_SECRET, challenges can only be solved for the instance that issued them")
+		}
+	}
+
+	return Challenges{secret, difficulty, store}
+}
+
+// Required reports whether posts need a proof of work at all
+func (ch Challenges) Required() bool {
+	return ch.difficulty > 0
+}
+
+// Issue returns a new challenge for ip, harder to solve the more posts were recently created
+func (ch Challenges) Issue(ctx context.Context, ip string) (*model.Challenge, error) {
+	if !ch.Required() {
+		return &model.Challenge{}, nil
+	}
+
+	difficulty, err := ch.currentDifficulty(ctx, ip)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 16)
+	if _, err = rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().UTC().Add(challengeTTL).Truncate(time.Second)
+	payload := fmt.Sprintf("%d.%d.%s", expiresAt.Unix(), difficulty, hex.EncodeToString(salt))
+	return &model.Challenge{
+		Challenge:  fmt.Sprintf("%s.%s", payload, ch.sign(payload)),
+		Difficulty: difficulty,
+		ExpiresAt:  &expiresAt,
+	}, nil
+}
+
+// currentDifficulty returns how hard a challenge for ip should be, given the posts recently created
+func (ch Challenges) currentDifficulty(ctx context.Context, ip string) (int, error) {
+	overall, err := ch.store.Count(ctx, "posts-created", challengeTTL)
+	if err != nil {
+		return 0, err
+	}
+	created, err := ch.store.Count(ctx, fmt.Sprintf("posts-created:%s", ip), challengeTTL)
+	if err != nil {
+		return 0, err
+	}
+
+	difficulty := ch.difficulty + extraDifficulty(overall, volumeThreshold) + extraDifficulty(created, ipThreshold)
+	return min(difficulty, maxDifficulty), nil
+}
+
+// Created counts a post created by ip, making the challenges issued afterwards harder
+func (ch Challenges) Created(ctx context.Context, ip string) error {
+	if !ch.Required() {
+		return nil
+	}
+	if _, _, err := ch.store.Increment(ctx, "posts-created", challengeTTL); err != nil {
+		return err
+	}
+	_, _, err := ch.store.Increment(ctx, fmt.Sprintf("posts-created:%s", ip), challengeTTL)
+	return err
+}
+
+// extraDifficulty returns a bit of difficulty for each doubling of count over threshold
+func extraDifficulty(count, threshold int) int {
+	if count <= threshold {
+		return 0
+	}
+	return bits.Len(uint(count / threshold))
+}
+
+// Verify ensures proof solves challenge for the post titled title with signature, using up challenge
+func (ch Challenges) Verify(ctx context.Context, challenge, proof, title, signature string) error {
+	if !ch.Required() {
+		return nil
+	}
+	if len(challenge) == 0 || len(proof) == 0 {
+		proofFailures.WithLabelValues("missing").Inc()
+		return fmt.Errorf("%w: posts require solving a challenge from /challenges", ErrInvalidProof)
+	}
+
+	expiresAt, difficulty, err := ch.parse(challenge)
+	if err != nil {
+		proofFailures.WithLabelValues("invalid_challenge").Inc()
+		return err
+	}
+
+	if time.Now().After(expiresAt) {
+		proofFailures.WithLabelValues("expired").Inc()
+		return fmt.Errorf("%w: the challenge has expired, request a new one", ErrInvalidProof)
+	}
+
+	if leadingZeroBits(proofHash(challenge, title, signature, proof)) < difficulty {
+		proofFailures.WithLabelValues("insufficient").Inc()
+		return fmt.Errorf("%w: the proof doesn't solve the challenge", ErrInvalidProof)
+	}
+
+	// remembered until it expires, past which it's refused anyway
+	used, err := ch.store.Remember(ctx, fmt.Sprintf("challenge:%s", challenge), time.Until(expiresAt))
+	if err != nil {
+		return err
+	}
+	if used {
+		proofFailures.WithLabelValues("reused").Inc()
+		return fmt.Errorf("%w: the challenge has already been solved, request a new one", ErrInvalidProof)
+	}
+	return nil
+}
+
+// parse returns when challenge expires and how difficult it is, provided it was issued by ch
+func (ch Challenges) parse(challenge string) (time.Time, int, error) {
+	invalid := fmt.Errorf("%w: unrecognised challenge", ErrInvalidProof)
+
+	i := strings.LastIndex(challenge, ".")
+	if i == -1 {
+		return time.Time{}, 0, invalid
+	}
+	payload, mac := challenge[:i], challenge[i+1:]
+	if !hmac.Equal([]byte(mac), []byte(ch.sign(payload))) {
+		return time.Time{}, 0, invalid
+	}
+
+	parts := strings.Split(payload, ".")
+	if len(parts) != 3 {
+		return time.Time{}, 0, invalid
+	}
+	expiresAt, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, 0, invalid
+	}
+	difficulty, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return time.Time{}, 0, invalid
+	}
+
+	return time.Unix(expiresAt, 0), difficulty, nil
+}
+
+func (ch Challenges) sign(payload string) string {
+	mac := hmac.New(sha256.New, ch.secret)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// proofHash returns the hash a proof has to find enough leading zero bits in
+func proofHash(challenge, title, signature, proof string) []byte {
+	signature = strings.Join(strings.Fields(signature), "")
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%s:%s:%s:%s", challenge, title, signature, proof)))
+	return hash[:]
+}
+
+func leadingZeroBits(hash []byte) int {
+	zeros := 0
+	for _, b := range hash {
+		if b != 0 {
+			return zeros + bits.LeadingZeros8(b)
+		}
+		zeros += 8
+	}
+	return zeros
+}
+
+// getChallenge issues a challenge to the ip asking for one, as told by IPExtractor so that clients can't pass for
+// another ip to get easier challenges. Challenges are never cached, each is for a single post
+func (ch Challenges) getChallenge(c echo.Context) error {
+	challenge, err := ch.Issue(c.Request().Context(), c.RealIP())
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	return c.JSON(http.StatusOK, challenge)
+}
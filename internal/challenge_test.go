@@ -0,0 +1,182 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jtanza/post-pigeon/internal/model"
+	"github.com/labstack/echo/v4"
+)
+
+func solve(challenge string, difficulty int, title, signature string) string {
+	for proof := 0; ; proof++ {
+		if leadingZeroBits(proofHash(challenge, title, signature, strconv.Itoa(proof))) >= difficulty {
+			return strconv.Itoa(proof)
+		}
+	}
+}
+
+func TestChallenges(t *testing.T) {
+	ch := Challenges{[]byte("secret"), 8, NewMemoryRateLimitStore()}
+	challenge, err := ch.Issue(context.Background(), "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if challenge.Difficulty != 8 {
+		t.Errorf("expected a difficulty of 8 got %d", challenge.Difficulty)
+	}
+
+	proof := solve(challenge.Challenge, challenge.Difficulty, "title", "c2lnbmF0dXJl")
+	if err = ch.Verify(context.Background(), challenge.Challenge, proof, "title", "c2ln\nbmF0dXJl"); err != nil {
+		t.Errorf("expected the proof to solve the challenge, whitespace in the signature aside: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		challenge string
+		proof     string
+		title     string
+	}{
+		{"missing", "", "", "title"},
+		{"another post", challenge.Challenge, proof, "another title"},
+		{"tampered", strings.Replace(challenge.Challenge, ".8.", ".0.", 1), proof, "title"},
+		{"foreign", challenge.Challenge[:strings.LastIndex(challenge.Challenge, ".")] + ".abc", proof, "title"},
+	}
+	for _, test := range tests {
+		if err := ch.Verify(context.Background(), test.challenge, test.proof, test.title, "c2lnbmF0dXJl"); !errors.Is(err, ErrInvalidProof) {
+			t.Errorf("%s: expected an invalid proof got %v", test.name, err)
+		}
+	}
+}
+
+func TestChallengeSolvedOnce(t *testing.T) {
+	ch := Challenges{[]byte("secret"), 1, NewMemoryRateLimitStore()}
+	challenge, err := ch.Issue(context.Background(), "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proof := solve(challenge.Challenge, challenge.Difficulty, "title", "signature")
+	if err = ch.Verify(context.Background(), challenge.Challenge, proof, "title", "signature"); err != nil {
+		t.Fatalf("expected the proof to solve the challenge: %v", err)
+	}
+	if err = ch.Verify(context.Background(), challenge.Challenge, proof, "title", "signature"); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("expected a challenge solved already to be refused got %v", err)
+	}
+}
+
+func TestChallengesHarderWithPostsCreated(t *testing.T) {
+	ch := Challenges{[]byte("secret"), 1, NewMemoryRateLimitStore()}
+	for i := 0; i < 3*ipThreshold; i++ {
+		if _, err := ch.Issue(context.Background(), "192.0.2.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if challenge, _ := ch.Issue(context.Background(), "192.0.2.1"); challenge.Difficulty != 1 {
+		t.Errorf("expected asking for challenges not to make them harder got a difficulty of %d", challenge.Difficulty)
+	}
+
+	for i := 0; i < 2*ipThreshold; i++ {
+		if err := ch.Created(context.Background(), "192.0.2.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if challenge, _ := ch.Issue(context.Background(), "192.0.2.1"); challenge.Difficulty != 3 {
+		t.Errorf("expected posts created to make challenges harder got a difficulty of %d", challenge.Difficulty)
+	}
+	if challenge, _ := ch.Issue(context.Background(), "192.0.2.2"); challenge.Difficulty != 1 {
+		t.Errorf("expected other ips to get challenges as hard as before got a difficulty of %d", challenge.Difficulty)
+	}
+}
+
+func TestExpiredChallenge(t *testing.T) {
+	ch := Challenges{[]byte("secret"), 1, NewMemoryRateLimitStore()}
+	payload := fmt.Sprintf("%d.1.abc", time.Now().Add(-time.Minute).Unix())
+	challenge := fmt.Sprintf("%s.%s", payload, ch.sign(payload))
+
+	proof := solve(challenge, 1, "title", "signature")
+	if err := ch.Verify(context.Background(), challenge, proof, "title", "signature"); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("expected an expired challenge to be refused got %v", err)
+	}
+}
+
+func TestChallengesNotRequired(t *testing.T) {
+	ch := Challenges{[]byte("secret"), 0, NewMemoryRateLimitStore()}
+	if err := ch.Verify(context.Background(), "", "", "title", "signature"); err != nil {
+		t.Errorf("expected no proof to be required got %v", err)
+	}
+}
+
+func TestExtraDifficulty(t *testing.T) {
+	tests := []struct {
+		count    int
+		expected int
+	}{
+		{5, 0},
+		{10, 0},
+		{11, 1},
+		{20, 2},
+		{40, 3},
+		{1000, 7},
+	}
+
+	for _, test := range tests {
+		if extra := extraDifficulty(test.count, 10); extra != test.expected {
+			t.Errorf("expected %d posts over 10 to add %d bits got %d", test.count, test.expected, extra)
+		}
+	}
+}
+
+func TestLeadingZeroBits(t *testing.T) {
+	tests := []struct {
+		hash     []byte
+		expected int
+	}{
+		{[]byte{0xff}, 0},
+		{[]byte{0x0f}, 4},
+		{[]byte{0x00, 0x01}, 15},
+		{[]byte{0x00, 0x00}, 16},
+	}
+
+	for _, test := range tests {
+		if zeros := leadingZeroBits(test.hash); zeros != test.expected {
+			t.Errorf("expected %x to start with %d zero bits got %d", test.hash, test.expected, zeros)
+		}
+	}
+}
+
+func TestChallengesGoByTrustedIPs(t *testing.T) {
+	t.Setenv("POST_PIGEON_AUDIT_KEY", "secret")
+	db := newTestDB(t)
+	pm := newTestPostManager(t, db)
+	ch := Challenges{[]byte("secret"), 1, NewMemoryRateLimitStore()}
+	e := NewRouter(db, pm, NewHealth(db, pm), RateLimits{}, ch).Engine()
+
+	// httptest requests come from 192.0.2.1
+	for i := 0; i < 2*ipThreshold; i++ {
+		if err := ch.Created(context.Background(), "192.0.2.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/challenges", nil)
+	request.Header.Set(echo.HeaderXForwardedFor, "203.0.113.7")
+	recorder := httptest.NewRecorder()
+	e.ServeHTTP(recorder, request)
+
+	var challenge model.Challenge
+	if err := json.Unmarshal(recorder.Body.Bytes(), &challenge); err != nil {
+		t.Fatalf("could not read challenge %q: %v", recorder.Body.String(), err)
+	}
+	if challenge.Difficulty != 3 {
+		t.Errorf("expected a made up X-Forwarded-For not to get around harder challenges got a difficulty of %d", challenge.Difficulty)
+	}
+}
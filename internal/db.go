@@ -1,50 +1,75 @@
 package internal
 
 import (
+	"context"
 	"errors"
-	"log"
+	"fmt"
 	"time"
 
 	"github.com/jtanza/post-pigeon/internal/model"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
+	"gorm.io/gorm/clause"
+	gormlogger "gorm.io/gorm/logger"
 	"gorm.io/gorm/schema"
 )
 
+const fullPostColumns = "post.id, post.uuid, post.key, post.fingerprint, post.signature, post.slug, post.status, post.publish_at, post.created_at, post.expires_at, post_content.title, post_content.html, post_content.message"
+
 type DB struct {
 	db *gorm.DB
 }
 
 func NewDB() DB {
 	db, err := gorm.Open(sqlite.Open(createDSN()), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Warn),
+		Logger: gormLogger{level: gormlogger.Info},
 		NamingStrategy: schema.NamingStrategy{
 			SingularTable: true,
 		},
 	})
 	if err != nil {
-		log.Fatal(err)
+		Fatal("could not open db", "error", err)
+	}
+	if err = instrumentDB(db); err != nil {
+		Fatal("could not instrument db", "error", err)
 	}
 
 	return DB{db}
 }
 
-// PersistPost derives a model.Post and model.PostContent from the provided request and persists them to the db
-func (d DB) PersistPost(postUUID string, request model.PostRequest, html string, expiration *time.Time) error {
-	return d.db.Transaction(func(tx *gorm.DB) error {
-		fingerprint, err := Fingerprint(request.PublicKey)
-		if err != nil {
-			return err
-		}
+// WithContext returns a copy of d running its queries, and logging them, on behalf of ctx
+func (d DB) WithContext(ctx context.Context) DB {
+	return DB{d.db.WithContext(ctx)}
+}
+
+// Ping checks the db can be reached
+func (d DB) Ping(ctx context.Context) error {
+	sqlDB, err := d.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
 
-		post := model.Post{UUID: postUUID, Key: request.PublicKey, Fingerprint: fingerprint, ExpiresAt: expiration}
+// SchemaVersion returns the version the schema was left at by the last migration applied to it
+func (d DB) SchemaVersion() (int, error) {
+	var version int
+	if versionQuery := d.db.Raw("pragma user_version").Scan(&version); versionQuery.Error != nil {
+		return 0, versionQuery.Error
+	}
+	return version, nil
+}
+
+// PersistPost persists post along with the model.PostContent derived from the provided request and the post tags,
+// recording audit all at once
+func (d DB) PersistPost(post model.Post, request model.PostRequest, html string, tags []string, audit model.AuditEntry) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
 		if postResult := tx.Create(&post); postResult.Error != nil {
 			return postResult.Error
 		}
 
 		postLocation := model.PostContent{
-			PostUUID: postUUID,
+			PostUUID: post.UUID,
 			HTML:     html,
 			Message:  request.Body,
 			Title:    request.Title,
@@ -53,22 +78,33 @@ func (d DB) PersistPost(postUUID string, request model.PostRequest, html string,
 			return postLocationResult.Error
 		}
 
-		return nil
+		for _, tag := range tags {
+			if tagResult := tx.Create(&model.PostTag{PostUUID: post.UUID, Tag: tag}); tagResult.Error != nil {
+				return tagResult.Error
+			}
+		}
+
+		return tx.Create(&audit).Error
 	})
 }
 
-// DeletePost drops from the db the model.Post and model.PostContent associated with the postDeleteRequest
-func (d DB) DeletePost(postDeleteRequest model.PostDeleteRequest) error {
+// DeletePost drops from the db the model.Post, model.PostContent and model.PostTag associated with the postDeleteRequest,
+// recording audit all at once
+func (d DB) DeletePost(postDeleteRequest model.PostDeleteRequest, audit model.AuditEntry) error {
 	return d.db.Transaction(func(tx *gorm.DB) error {
-		if postDelete := d.db.Unscoped().Where("uuid = ?", postDeleteRequest.UUID).Delete(&model.Post{}); postDelete.Error != nil {
+		if postDelete := tx.Unscoped().Where("uuid = ?", postDeleteRequest.UUID).Delete(&model.Post{}); postDelete.Error != nil {
 			return postDelete.Error
 		}
 
-		if postContentDelete := d.db.Unscoped().Where("post_uuid = ?", postDeleteRequest.UUID).Delete(&model.PostContent{}); postContentDelete.Error != nil {
+		if postContentDelete := tx.Unscoped().Where("post_uuid = ?", postDeleteRequest.UUID).Delete(&model.PostContent{}); postContentDelete.Error != nil {
 			return postContentDelete.Error
 		}
 
-		return nil
+		if postTagDelete := tx.Unscoped().Where("post_uuid = ?", postDeleteRequest.UUID).Delete(&model.PostTag{}); postTagDelete.Error != nil {
+			return postTagDelete.Error
+		}
+
+		return tx.Create(&audit).Error
 	})
 }
 
@@ -94,23 +130,798 @@ func (d DB) GetPost(postUUID string) (*model.Post, error) {
 	return &post, nil
 }
 
-// GetUserPosts returns all known posts published by the provided fingerprint
-func (d DB) GetUserPosts(fingerprint string) ([]model.FullPost, error) {
+// visible restricts query to the posts that are public right now: published ones, and scheduled ones whose
+// time has come but which the background worker has yet to flip, provided they can be served at all
+func visible(query *gorm.DB) *gorm.DB {
+	return servable(query).Where("(post.status = ? or (post.status = ? and post.publish_at <= ?))", PostPublished, PostScheduled, time.Now().UTC())
+}
+
+// servable restricts query to the posts that haven't expired nor been taken down by the operators
+func servable(query *gorm.DB) *gorm.DB {
+	return unexpired(query).Where("post.taken_down_at is null")
+}
+
+// unexpired restricts query to the posts that haven't expired, whether or not they've been reaped yet
+func unexpired(query *gorm.DB) *gorm.DB {
+	return query.Where("(post.expires_at is null or post.expires_at > ?)", time.Now().UTC())
+}
+
+// GetFullPost returns the public model.Post identified by postUUID joined with its model.PostContent
+func (d DB) GetFullPost(postUUID string) (*model.FullPost, error) {
+	return d.getFullPost(visible(d.db.Model(&model.Post{})).Where("post.uuid = ?", postUUID))
+}
+
+// GetDraft returns the unpublished model.Post that can be previewed with token, joined with its model.PostContent
+func (d DB) GetDraft(token string) (*model.FullPost, error) {
+	return d.getFullPost(servable(d.db.Model(&model.Post{})).Where("post.preview_token = ? and post.status in ?", token, []string{PostDraft, PostScheduled}))
+}
+
+func (d DB) getFullPost(query *gorm.DB) (*model.FullPost, error) {
+	var post model.FullPost
+	if postQuery := query.Select(fullPostColumns).Joins("join post_content on post.uuid = post_content.post_uuid").Take(&post); postQuery.Error != nil {
+		if errors.Is(postQuery.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, postQuery.Error
+	}
+
+	tags, err := d.GetPostTags(post.UUID)
+	if err != nil {
+		return nil, err
+	}
+	post.Tags = tags
+
+	return &post, nil
+}
+
+// PublishPost moves the draft identified by postUUID to status, dating it from publishedAt, recording audit all at
+// once. Only scheduled posts keep their preview token, until they go live
+func (d DB) PublishPost(postUUID string, status string, publishedAt time.Time, audit model.AuditEntry) error {
+	updates := map[string]interface{}{
+		"status":     status,
+		"created_at": publishedAt,
+	}
+	if status != PostScheduled {
+		updates["preview_token"] = nil
+	}
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		if postUpdate := tx.Model(&model.Post{}).Where("uuid = ? and status = ?", postUUID, PostDraft).Updates(updates); postUpdate.Error != nil {
+			return postUpdate.Error
+		}
+		return tx.Create(&audit).Error
+	})
+}
+
+// PublishScheduledPosts flips every scheduled post whose publish_at has passed to published. Each post published is
+// recorded in the audit log as audit
+func (d DB) PublishScheduledPosts(audit model.AuditEntry) (int64, error) {
+	var published []string
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		if postQuery := tx.Model(&model.Post{}).Where("status = ? and publish_at <= ?", PostScheduled, time.Now().UTC()).Pluck("uuid", &published); postQuery.Error != nil {
+			return postQuery.Error
+		}
+		if len(published) == 0 {
+			return nil
+		}
+
+		postUpdate := tx.Model(&model.Post{}).Where("uuid in ?", published).Updates(map[string]interface{}{
+			"status":        PostPublished,
+			"preview_token": nil,
+		})
+		if postUpdate.Error != nil {
+			return postUpdate.Error
+		}
+		return createAuditEntries(tx, audit, published)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(published)), nil
+}
+
+// GetPostUUIDBySlug returns the uuid of the post published by any of fingerprints under slug, if there is one
+func (d DB) GetPostUUIDBySlug(fingerprints []string, slug string) (string, error) {
+	var post model.Post
+	if postQuery := d.db.Where("fingerprint in ? and slug = ?", fingerprints, slug).First(&post); postQuery.Error != nil {
+		if errors.Is(postQuery.Error, gorm.ErrRecordNotFound) {
+			return "", nil
+		}
+		return "", postQuery.Error
+	}
+	return post.UUID, nil
+}
+
+// PersistHandle registers a model.Handle
+func (d DB) PersistHandle(handle model.Handle) error {
+	return d.db.Create(&handle).Error
+}
+
+// GetHandle returns the model.Handle registered under handle, if there is one
+func (d DB) GetHandle(handle string) (*model.Handle, error) {
+	var h model.Handle
+	if handleQuery := d.db.Where("handle = ?", handle).First(&h); handleQuery.Error != nil {
+		if errors.Is(handleQuery.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, handleQuery.Error
+	}
+	return &h, nil
+}
+
+// GetFingerprintHandle returns the model.Handle registered to fingerprint, if there is one
+func (d DB) GetFingerprintHandle(fingerprint string) (*model.Handle, error) {
+	var h model.Handle
+	if handleQuery := d.db.Where("fingerprint = ?", fingerprint).First(&h); handleQuery.Error != nil {
+		if errors.Is(handleQuery.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, handleQuery.Error
+	}
+	return &h, nil
+}
+
+// PersistProfile stores a new version of a model.Profile
+func (d DB) PersistProfile(profile model.Profile) error {
+	return d.db.Create(&profile).Error
+}
+
+// GetProfile returns the latest version of the model.Profile published by fingerprint, if there is one
+func (d DB) GetProfile(fingerprint string) (*model.Profile, error) {
+	var profile model.Profile
+	if profileQuery := d.db.Where("fingerprint = ?", fingerprint).Order("version desc").First(&profile); profileQuery.Error != nil {
+		if errors.Is(profileQuery.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, profileQuery.Error
+	}
+	return &profile, nil
+}
+
+// GetProfileHistory returns every version of the model.Profile published by fingerprint, newest first
+func (d DB) GetProfileHistory(fingerprint string) ([]model.Profile, error) {
+	var profiles []model.Profile
+	if profileQuery := d.db.Where("fingerprint = ?", fingerprint).Order("version desc").Find(&profiles); profileQuery.Error != nil {
+		return nil, profileQuery.Error
+	}
+	return profiles, nil
+}
+
+// PersistKeyRotation records a model.KeyRotation
+func (d DB) PersistKeyRotation(rotation model.KeyRotation) error {
+	return d.db.Create(&rotation).Error
+}
+
+// GetRotationFrom returns the model.KeyRotation away from fingerprint, if it has been rotated
+func (d DB) GetRotationFrom(fingerprint string) (*model.KeyRotation, error) {
+	return d.getRotation("from_fingerprint = ?", fingerprint)
+}
+
+// GetRotationTo returns the model.KeyRotation that introduced fingerprint, if there is one
+func (d DB) GetRotationTo(fingerprint string) (*model.KeyRotation, error) {
+	return d.getRotation("to_fingerprint = ?", fingerprint)
+}
+
+func (d DB) getRotation(query string, fingerprint string) (*model.KeyRotation, error) {
+	var rotation model.KeyRotation
+	if rotationQuery := d.db.Where(query, fingerprint).First(&rotation); rotationQuery.Error != nil {
+		if errors.Is(rotationQuery.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, rotationQuery.Error
+	}
+	return &rotation, nil
+}
+
+// PersistKeyRevocation records a model.KeyRevocation along with the model.KeyRotation to its successor, if there is one,
+// and entry. With takedown, every post published by the revoked key is dropped in the same transaction, each recorded in
+// the audit log as takedown. Returns the uuids of the posts dropped
+func (d DB) PersistKeyRevocation(revocation model.KeyRevocation, succession *model.KeyRotation, entry model.AuditEntry, takedown *model.AuditEntry) ([]string, error) {
+	var deleted []string
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		if revocationResult := tx.Create(&revocation); revocationResult.Error != nil {
+			return revocationResult.Error
+		}
+
+		if succession != nil {
+			if rotationResult := tx.Create(succession); rotationResult.Error != nil {
+				return rotationResult.Error
+			}
+		}
+
+		if err := tx.Create(&entry).Error; err != nil {
+			return err
+		}
+
+		if takedown == nil {
+			return nil
+		}
+
+		if postQuery := tx.Unscoped().Model(&model.Post{}).Where("fingerprint = ?", revocation.Fingerprint).Pluck("uuid", &deleted); postQuery.Error != nil {
+			return postQuery.Error
+		}
+		if len(deleted) == 0 {
+			return nil
+		}
+
+		if postContentDelete := tx.Unscoped().Where("post_uuid in ?", deleted).Delete(&model.PostContent{}); postContentDelete.Error != nil {
+			return postContentDelete.Error
+		}
+
+		if postTagDelete := tx.Unscoped().Where("post_uuid in ?", deleted).Delete(&model.PostTag{}); postTagDelete.Error != nil {
+			return postTagDelete.Error
+		}
+
+		if postDelete := tx.Unscoped().Where("uuid in ?", deleted).Delete(&model.Post{}); postDelete.Error != nil {
+			return postDelete.Error
+		}
+
+		return createAuditEntries(tx, *takedown, deleted)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
+// GetRevocation returns the model.KeyRevocation of fingerprint, if it has been revoked
+func (d DB) GetRevocation(fingerprint string) (*model.KeyRevocation, error) {
+	var revocation model.KeyRevocation
+	if revocationQuery := d.db.Where("fingerprint = ?", fingerprint).First(&revocation); revocationQuery.Error != nil {
+		if errors.Is(revocationQuery.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, revocationQuery.Error
+	}
+	return &revocation, nil
+}
+
+// SaveDomainVerification creates or updates a model.DomainVerification
+func (d DB) SaveDomainVerification(claim model.DomainVerification) error {
+	return d.db.Save(&claim).Error
+}
+
+// GetDomainVerification returns the claim of fingerprint to domain, if there is one
+func (d DB) GetDomainVerification(domain, fingerprint string) (*model.DomainVerification, error) {
+	var claim model.DomainVerification
+	if claimQuery := d.db.Where("domain = ? and fingerprint = ?", domain, fingerprint).First(&claim); claimQuery.Error != nil {
+		if errors.Is(claimQuery.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, claimQuery.Error
+	}
+	return &claim, nil
+}
+
+// GetDomainVerifications returns every claim made to domain
+func (d DB) GetDomainVerifications(domain string) ([]model.DomainVerification, error) {
+	var claims []model.DomainVerification
+	if claimQuery := d.db.Where("domain = ?", domain).Order("id").Find(&claims); claimQuery.Error != nil {
+		return nil, claimQuery.Error
+	}
+	return claims, nil
+}
+
+// GetVerifiedDomain returns the earliest verified domain claimed by fingerprint, if there is one
+func (d DB) GetVerifiedDomain(fingerprint string) (*model.DomainVerification, error) {
+	var claim model.DomainVerification
+	if claimQuery := d.db.Where("fingerprint = ? and status = ?", fingerprint, DomainVerified).Order("verified_at").First(&claim); claimQuery.Error != nil {
+		if errors.Is(claimQuery.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, claimQuery.Error
+	}
+	return &claim, nil
+}
+
+// GetDomainsToCheck returns the pending claims, along with the verified claims last checked before recheckBefore
+func (d DB) GetDomainsToCheck(recheckBefore time.Time) ([]model.DomainVerification, error) {
+	var claims []model.DomainVerification
+	claimQuery := d.db.Where("status = ? or (status = ? and checked_at < ?)", DomainPending, DomainVerified, recheckBefore).Order("id").Find(&claims)
+	if claimQuery.Error != nil {
+		return nil, claimQuery.Error
+	}
+	return claims, nil
+}
+
+// GetPostTags returns the tags of the post identified by postUUID
+func (d DB) GetPostTags(postUUID string) ([]string, error) {
+	var tags []string
+	if tagQuery := d.db.Model(&model.PostTag{}).Where("post_uuid = ?", postUUID).Order("id").Pluck("tag", &tags); tagQuery.Error != nil {
+		return nil, tagQuery.Error
+	}
+	return tags, nil
+}
+
+// GetAuthorPosts returns every public post published by any of fingerprints, the oldest first
+func (d DB) GetAuthorPosts(fingerprints []string) ([]model.FullPost, error) {
+	posts := []model.FullPost{}
+	postQuery := visible(d.db.Model(&model.Post{})).Select(fullPostColumns).
+		Joins("join post_content on post.uuid = post_content.post_uuid").
+		Where("post.fingerprint in ?", fingerprints).
+		Order("post.created_at, post.id").
+		Scan(&posts)
+	if postQuery.Error != nil {
+		return nil, postQuery.Error
+	}
+	return posts, nil
+}
+
+// GetPosts returns the window of posts described by listing, in the order it requests.
+// Listings paging backwards from a cursor are returned in reverse
+func (d DB) GetPosts(listing PostListing) ([]model.FullPost, error) {
+	query := visible(d.db.Model(&model.Post{})).Select(fullPostColumns).Joins("join post_content on post.uuid = post_content.post_uuid")
+	if len(listing.Fingerprints) > 0 {
+		query = query.Where("post.fingerprint in ?", listing.Fingerprints)
+	}
+	if listing.From != nil {
+		query = query.Where("post.created_at >= ?", *listing.From)
+	}
+	if listing.To != nil {
+		query = query.Where("post.created_at < ?", *listing.To)
+	}
+	if len(listing.Tag) > 0 {
+		query = query.Where("exists (select 1 from post_tag where post_tag.post_uuid = post.uuid and post_tag.tag = ? and post_tag.deleted_at is null)", listing.Tag)
+	}
+
+	desc := listing.Sort.desc
+	if listing.Cursor != nil {
+		if listing.Cursor.Before {
+			desc = !desc
+		}
+		op := ">"
+		if desc {
+			op = "<"
+		}
+		value := listing.Cursor.value()
+		query = query.Where(fmt.Sprintf("(%[1]s %[2]s ? or (%[1]s = ? and post.id %[2]s ?))", listing.Sort.column, op), value, value, listing.Cursor.ID)
+	}
+
+	direction := "asc"
+	if desc {
+		direction = "desc"
+	}
+
 	var posts []model.FullPost
-	if postQuery := d.db.Model(&model.Post{}).Select("post.UUID, post.Key, post.Fingerprint, post.created_at, post_content.Title, post_content.HTML, post_content.Message").Joins("left join post_content on post.uuid = post_content.post_uuid").Where("post.fingerprint = ?", fingerprint).Scan(&posts); postQuery.Error != nil {
+	if postQuery := query.Order(fmt.Sprintf("%[1]s %[2]s, post.id %[2]s", listing.Sort.column, direction)).Limit(listing.Limit).Scan(&posts); postQuery.Error != nil {
 		return nil, postQuery.Error
 	}
 	return posts, nil
 }
 
-func (d DB) DeleteExpiredPosts() (int64, error) {
-	postQuery := d.db.Unscoped().Model(&model.Post{}).Where("expires_at <= datetime('now')").Delete(&model.Post{})
+// GetFingerprintsByPrefix returns the distinct fingerprints of authors of posts starting with prefix
+func (d DB) GetFingerprintsByPrefix(prefix string) ([]string, error) {
+	var fingerprints []string
+	if postQuery := visible(d.db.Model(&model.Post{})).Distinct("fingerprint").Where("substr(fingerprint, 1, ?) = ?", len(prefix), prefix).Limit(2).Pluck("fingerprint", &fingerprints); postQuery.Error != nil {
+		return nil, postQuery.Error
+	}
+	return fingerprints, nil
+}
+
+// CountTagPosts returns the number of posts tagged with tag
+func (d DB) CountTagPosts(tag string) (int64, error) {
+	var count int64
+	if countQuery := visible(d.db.Model(&model.PostTag{}).Joins("join post on post.uuid = post_tag.post_uuid and post.deleted_at is null")).Where("post_tag.tag = ?", tag).Count(&count); countQuery.Error != nil {
+		return 0, countQuery.Error
+	}
+	return count, nil
+}
+
+// CountUserPosts returns the number of posts published by any of the provided fingerprints
+func (d DB) CountUserPosts(fingerprints []string) (int64, error) {
+	var count int64
+	if countQuery := visible(d.db.Model(&model.Post{})).Where("post.fingerprint in ?", fingerprints).Count(&count); countQuery.Error != nil {
+		return 0, countQuery.Error
+	}
+	return count, nil
+}
+
+// DeleteExpiredPosts drops every post past its expiration, along with its content and tags, returning the uuids
+// of the posts it dropped. Each post dropped is recorded in the audit log as audit
+func (d DB) DeleteExpiredPosts(audit model.AuditEntry) ([]string, error) {
+	var deleted []string
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UTC()
+		if postQuery := tx.Unscoped().Model(&model.Post{}).Where("expires_at <= ?", now).Pluck("uuid", &deleted); postQuery.Error != nil {
+			return postQuery.Error
+		}
+		if len(deleted) == 0 {
+			return nil
+		}
+
+		expired := tx.Unscoped().Model(&model.Post{}).Select("uuid").Where("expires_at <= ?", now)
+		if contentDelete := tx.Unscoped().Where("post_uuid in (?)", expired).Delete(&model.PostContent{}); contentDelete.Error != nil {
+			return contentDelete.Error
+		}
+		if tagDelete := tx.Unscoped().Where("post_uuid in (?)", expired).Delete(&model.PostTag{}); tagDelete.Error != nil {
+			return tagDelete.Error
+		}
+
+		if postDelete := tx.Unscoped().Where("expires_at <= ?", now).Delete(&model.Post{}); postDelete.Error != nil {
+			return postDelete.Error
+		}
+
+		return createAuditEntries(tx, audit, deleted)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
+// DeleteExpiredDrafts drops every draft created before createdBefore that was never published, along with its content and tags.
+// Each draft dropped is recorded in the audit log as audit
+func (d DB) DeleteExpiredDrafts(createdBefore time.Time, audit model.AuditEntry) (int64, error) {
+	var deleted int64
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		var expiredUUIDs []string
+		if draftQuery := tx.Unscoped().Model(&model.Post{}).Where("status = ? and created_at <= ?", PostDraft, createdBefore).Pluck("uuid", &expiredUUIDs); draftQuery.Error != nil {
+			return draftQuery.Error
+		}
+		if len(expiredUUIDs) == 0 {
+			return nil
+		}
+
+		expired := tx.Unscoped().Model(&model.Post{}).Select("uuid").Where("status = ? and created_at <= ?", PostDraft, createdBefore)
+		if contentDelete := tx.Unscoped().Where("post_uuid in (?)", expired).Delete(&model.PostContent{}); contentDelete.Error != nil {
+			return contentDelete.Error
+		}
+		if tagDelete := tx.Unscoped().Where("post_uuid in (?)", expired).Delete(&model.PostTag{}); tagDelete.Error != nil {
+			return tagDelete.Error
+		}
+
+		postQuery := tx.Unscoped().Where("status = ? and created_at <= ?", PostDraft, createdBefore).Delete(&model.Post{})
+		if postQuery.Error != nil {
+			return postQuery.Error
+		}
+		deleted = postQuery.RowsAffected
+
+		return createAuditEntries(tx, audit, expiredUUIDs)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// GetStoredBytes returns the bytes of markdown stored across every post of fingerprint
+func (d DB) GetStoredBytes(fingerprint string) (int64, error) {
+	var stored int64
+	storedQuery := d.db.Model(&model.PostContent{}).
+		Select("coalesce(sum(length(cast(post_content.message as blob))), 0)").
+		Joins("join post on post.uuid = post_content.post_uuid and post.deleted_at is null").
+		Where("post.fingerprint = ?", fingerprint).
+		Scan(&stored)
+	if storedQuery.Error != nil {
+		return 0, storedQuery.Error
+	}
+	return stored, nil
+}
+
+// IncrementRateLimit counts one more request under key within the window ending at windowEnd, returning how many
+// have been counted in it so far. Counts from earlier windows are started over
+func (d DB) IncrementRateLimit(key string, windowEnd time.Time) (int, error) {
+	var count int
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		upsert := tx.Exec(`insert into rate_limit (key, window_end, count) values (?, ?, 1)
+			on conflict (key) do update set
+				count = case when window_end = excluded.window_end then count + 1 else 1 end,
+				window_end = excluded.window_end`, key, windowEnd.Unix())
+		if upsert.Error != nil {
+			return upsert.Error
+		}
+		return tx.Raw("select count from rate_limit where key = ?", key).Scan(&count).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// GetRateLimit returns the count under key within the window ending at windowEnd, 0 when it's yet to be counted in
+func (d DB) GetRateLimit(key string, windowEnd time.Time) (int, error) {
+	var count int
+	if err := d.db.Raw("select count from rate_limit where key = ? and window_end = ?", key, windowEnd.Unix()).Scan(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// RememberKey records key until expiresAt, unless it's already recorded past now, returning how many times it
+// was recorded since it was first
+func (d DB) RememberKey(key string, now, expiresAt time.Time) (int, error) {
+	var count int
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		upsert := tx.Exec(`insert into rate_limit (key, window_end, count) values (?, ?, 1)
+			on conflict (key) do update set
+				count = case when window_end > ? then count + 1 else 1 end,
+				window_end = case when window_end > ? then window_end else excluded.window_end end`, key, expiresAt.Unix(), now.Unix(), now.Unix())
+		if upsert.Error != nil {
+			return upsert.Error
+		}
+		return tx.Raw("select count from rate_limit where key = ?", key).Scan(&count).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// DeleteEndedRateLimits drops the counts of every window that ended before endedBefore
+func (d DB) DeleteEndedRateLimits(endedBefore time.Time) (int64, error) {
+	rateLimitDelete := d.db.Exec("delete from rate_limit where window_end < ?", endedBefore.Unix())
+	return rateLimitDelete.RowsAffected, rateLimitDelete.Error
+}
+
+// PersistReport files report against the post it flags, recording entry
+func (d DB) PersistReport(report model.Report, entry model.AuditEntry) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&report).Error; err != nil {
+			return err
+		}
+		return tx.Create(&entry).Error
+	})
+}
+
+// GetReportedPosts returns every post with open reports, the most reported first, along with its open reports
+func (d DB) GetReportedPosts() ([]model.ReportedPost, error) {
+	posts := []model.ReportedPost{}
+	postQuery := d.db.Model(&model.Post{}).
+		Select("post.uuid, post.fingerprint, post.created_at, post_content.title, post_content.message").
+		Joins("join post_content on post.uuid = post_content.post_uuid").
+		Joins("join report on report.post_uuid = post.uuid and report.status = ? and report.deleted_at is null", ReportOpen).
+		Group("post.uuid").
+		Order("count(report.id) desc, min(report.created_at) asc").
+		Scan(&posts)
 	if postQuery.Error != nil {
-		return 0, postQuery.Error
+		return nil, postQuery.Error
+	}
+
+	for i := range posts {
+		if reportQuery := d.db.Where("post_uuid = ? and status = ?", posts[i].UUID, ReportOpen).Order("created_at asc").Find(&posts[i].Reports); reportQuery.Error != nil {
+			return nil, reportQuery.Error
+		}
+	}
+	return posts, nil
+}
+
+// TakeDownPost hides the post identified by postUUID for reason, resolving its open reports as actioned and
+// recording entry, all at once. Returns false if there's no such post
+func (d DB) TakeDownPost(postUUID, reason string, entry model.AuditEntry) (bool, error) {
+	found := false
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UTC()
+		postUpdate := tx.Model(&model.Post{}).Where("uuid = ?", postUUID).Updates(map[string]any{"taken_down_at": now, "takedown_reason": reason})
+		if postUpdate.Error != nil || postUpdate.RowsAffected == 0 {
+			return postUpdate.Error
+		}
+		found = true
+
+		if err := resolveReports(tx, postUUID, ReportActioned, now); err != nil {
+			return err
+		}
+		return tx.Create(&entry).Error
+	})
+	return found, err
+}
+
+// RestorePost reverses the takedown of the post identified by postUUID, recording entry. Returns false if there's
+// no such post taken down
+func (d DB) RestorePost(postUUID string, entry model.AuditEntry) (bool, error) {
+	found := false
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		postUpdate := tx.Model(&model.Post{}).Where("uuid = ? and taken_down_at is not null", postUUID).Updates(map[string]any{"taken_down_at": nil, "takedown_reason": nil})
+		if postUpdate.Error != nil || postUpdate.RowsAffected == 0 {
+			return postUpdate.Error
+		}
+		found = true
+
+		return tx.Create(&entry).Error
+	})
+	return found, err
+}
+
+// DismissReports resolves the open reports of the post identified by postUUID as dismissed, recording entry.
+// Returns false if the post has no open reports
+func (d DB) DismissReports(postUUID string, entry model.AuditEntry) (bool, error) {
+	found := false
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		reportUpdate := tx.Model(&model.Report{}).Where("post_uuid = ? and status = ?", postUUID, ReportOpen).Updates(map[string]any{"status": ReportDismissed, "resolved_at": time.Now().UTC()})
+		if reportUpdate.Error != nil || reportUpdate.RowsAffected == 0 {
+			return reportUpdate.Error
+		}
+		found = true
+
+		return tx.Create(&entry).Error
+	})
+	return found, err
+}
+
+func resolveReports(tx *gorm.DB, postUUID, status string, resolvedAt time.Time) error {
+	return tx.Model(&model.Report{}).Where("post_uuid = ? and status = ?", postUUID, ReportOpen).Updates(map[string]any{"status": status, "resolved_at": resolvedAt}).Error
+}
+
+// GetTakenDownPost returns the post identified by postUUID provided it was taken down, whether or not it has
+// since expired
+func (d DB) GetTakenDownPost(postUUID string) (*model.Post, error) {
+	var post model.Post
+	if postQuery := d.db.Where("uuid = ? and taken_down_at is not null", postUUID).First(&post); postQuery.Error != nil {
+		if errors.Is(postQuery.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, postQuery.Error
+	}
+	return &post, nil
+}
+
+// PersistBlocklistEntry adds entry to the blocklist, recording audit all at once. Returns false if its value is
+// already blocklisted
+func (d DB) PersistBlocklistEntry(entry model.BlocklistEntry, audit model.AuditEntry) (bool, error) {
+	created := false
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		entryCreate := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&entry)
+		if entryCreate.Error != nil || entryCreate.RowsAffected == 0 {
+			return entryCreate.Error
+		}
+		created = true
+
+		return tx.Create(&audit).Error
+	})
+	return created, err
+}
+
+// DeleteBlocklistEntry lifts value of kind from the blocklist, recording audit all at once. Returns false if it
+// wasn't blocklisted
+func (d DB) DeleteBlocklistEntry(kind, value string, audit model.AuditEntry) (bool, error) {
+	deleted := false
+	err := d.db.Transaction(func(tx *gorm.DB) error {
+		entryDelete := tx.Unscoped().Where("kind = ? and value = ?", kind, value).Delete(&model.BlocklistEntry{})
+		if entryDelete.Error != nil || entryDelete.RowsAffected == 0 {
+			return entryDelete.Error
+		}
+		deleted = true
+
+		return tx.Create(&audit).Error
+	})
+	return deleted, err
+}
+
+// GetBlocklistEntries returns every blocklist entry of kind, the latest first
+func (d DB) GetBlocklistEntries(kind string) ([]model.BlocklistEntry, error) {
+	entries := []model.BlocklistEntry{}
+	if entryQuery := d.db.Where("kind = ?", kind).Order("created_at desc").Find(&entries); entryQuery.Error != nil {
+		return nil, entryQuery.Error
 	}
-	return postQuery.RowsAffected, nil
+	return entries, nil
+}
+
+// GetBlocklist returns every blocklist entry, the latest first
+func (d DB) GetBlocklist() ([]model.BlocklistEntry, error) {
+	entries := []model.BlocklistEntry{}
+	if entryQuery := d.db.Order("created_at desc").Find(&entries); entryQuery.Error != nil {
+		return nil, entryQuery.Error
+	}
+	return entries, nil
+}
+
+// GetBlocklistEntry returns the blocklist entry with id, nil if there isn't one
+func (d DB) GetBlocklistEntry(id int) (*model.BlocklistEntry, error) {
+	var entry model.BlocklistEntry
+	if entryQuery := d.db.Where("id = ?", id).First(&entry); entryQuery.Error != nil {
+		if errors.Is(entryQuery.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, entryQuery.Error
+	}
+	return &entry, nil
+}
+
+// PersistAuditEntry records entry in the audit log
+func (d DB) PersistAuditEntry(entry model.AuditEntry) error {
+	return d.db.Create(&entry).Error
+}
+
+// createAuditEntries records audit in the audit log once for each of postUUIDs
+func createAuditEntries(tx *gorm.DB, audit model.AuditEntry, postUUIDs []string) error {
+	entries := make([]model.AuditEntry, 0, len(postUUIDs))
+	for i := range postUUIDs {
+		entry := audit
+		entry.PostUUID = &postUUIDs[i]
+		entries = append(entries, entry)
+	}
+	return tx.CreateInBatches(&entries, 100).Error
+}
+
+// GetAuditEntries returns the entries of the audit log matching query, the latest first
+func (d DB) GetAuditEntries(query model.AuditQuery) ([]model.AuditEntry, error) {
+	entryQuery := d.db.Model(&model.AuditEntry{})
+	if len(query.Action) > 0 {
+		entryQuery = entryQuery.Where("action = ?", query.Action)
+	}
+	if len(query.Actor) > 0 {
+		entryQuery = entryQuery.Where("actor = ?", query.Actor)
+	}
+	if len(query.Fingerprint) > 0 {
+		entryQuery = entryQuery.Where("fingerprint = ?", query.Fingerprint)
+	}
+	if len(query.PostUUID) > 0 {
+		entryQuery = entryQuery.Where("post_uuid = ?", query.PostUUID)
+	}
+	if len(query.From) > 0 {
+		from, err := time.Parse(time.DateOnly, query.From)
+		if err != nil {
+			return nil, err
+		}
+		entryQuery = entryQuery.Where("created_at >= ?", from)
+	}
+	if len(query.To) > 0 {
+		to, err := time.Parse(time.DateOnly, query.To)
+		if err != nil {
+			return nil, err
+		}
+		// dates are inclusive, so include everything up until the start of the following day
+		entryQuery = entryQuery.Where("created_at < ?", to.AddDate(0, 0, 1))
+	}
+	if query.Before > 0 {
+		entryQuery = entryQuery.Where("id < ?", query.Before)
+	}
+
+	entries := []model.AuditEntry{}
+	if findQuery := entryQuery.Order("id desc").Limit(query.Limit).Find(&entries); findQuery.Error != nil {
+		return nil, findQuery.Error
+	}
+	return entries, nil
+}
+
+// DeleteAuditEntries drops every entry of the audit log recorded before createdBefore
+func (d DB) DeleteAuditEntries(createdBefore time.Time) (int64, error) {
+	entryDelete := d.db.Where("created_at < ?", createdBefore).Delete(&model.AuditEntry{})
+	return entryDelete.RowsAffected, entryDelete.Error
+}
+
+// GetStats counts the posts of the instance by status, leaving out those taken down which are counted apart,
+// along with their authors, the bytes they take up, open reports and bans
+func (d DB) GetStats() (*model.Stats, error) {
+	stats := model.Stats{Posts: map[string]int64{}}
+
+	var statuses []struct {
+		Status string
+		Count  int64
+	}
+	statusQuery := unexpired(d.db.Model(&model.Post{})).Where("post.taken_down_at is null").Select("status, count(*) as count").Group("status").Scan(&statuses)
+	if statusQuery.Error != nil {
+		return nil, statusQuery.Error
+	}
+	for _, status := range statuses {
+		stats.Posts[status.Status] = status.Count
+	}
+
+	counts := []struct {
+		query *gorm.DB
+		count *int64
+	}{
+		{unexpired(d.db.Model(&model.Post{})).Where("post.taken_down_at is not null"), &stats.TakenDown},
+		{servable(d.db.Model(&model.Post{})).Distinct("fingerprint"), &stats.Authors},
+		{d.db.Model(&model.Report{}).Where("status = ?", ReportOpen), &stats.OpenReports},
+		{d.db.Model(&model.BlocklistEntry{}).Where("kind = ?", BlockFingerprint), &stats.Bans},
+	}
+	for _, c := range counts {
+		if countQuery := c.query.Count(c.count); countQuery.Error != nil {
+			return nil, countQuery.Error
+		}
+	}
+
+	storedQuery := d.db.Model(&model.PostContent{}).
+		Select("coalesce(sum(length(cast(message as blob))), 0)").
+		Scan(&stats.StoredBytes)
+	if storedQuery.Error != nil {
+		return nil, storedQuery.Error
+	}
+
+	return &stats, nil
 }
 
+// createDSN returns the data source of the db. SQLite leaves foreign keys unenforced unless asked to, each
+// connection needs to turn them on for the cascades the schema declares to take place
 func createDSN() string {
-	return "file:postpigeon.db"
+	return "file:" + DBFile + "?_foreign_keys=on"
 }
@@ -0,0 +1,188 @@
+package internal
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/bluele/gcache"
+	"github.com/jtanza/post-pigeon/internal/model"
+	"gorm.io/gorm"
+)
+
+// newTestDB returns a db opened exactly as NewDB opens postpigeon.db, in a temp dir the test runs in, migrated
+// through the latest migration
+func newTestDB(t *testing.T) DB {
+	return newTestDBAt(t, 0)
+}
+
+// newTestDBAt returns a db as newTestDB does, migrated through migration only, or every migration when 0
+func newTestDBAt(t *testing.T, migration int) DB {
+	migrations, err := filepath.Glob(filepath.Join(migrationsDir(t), "*.up.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	number := func(path string) int {
+		n, _ := strconv.Atoi(strings.SplitN(filepath.Base(path), "_", 2)[0])
+		return n
+	}
+	sort.Slice(migrations, func(i, j int) bool { return number(migrations[i]) < number(migrations[j]) })
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	db := NewDB()
+	t.Cleanup(func() {
+		if sqlDB, err := db.db.DB(); err == nil {
+			sqlDB.Close()
+		}
+		os.Chdir(wd)
+	})
+
+	for _, path := range migrations {
+		if migration > 0 && number(path) > migration {
+			break
+		}
+		statements, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = db.db.Exec(string(statements)).Error; err != nil {
+			t.Fatalf("could not apply %s: %v", path, err)
+		}
+	}
+	return db
+}
+
+// migrationsDir returns the absolute path of the migrations, which tests running in a temp dir can't find otherwise
+func migrationsDir(t *testing.T) string {
+	dir, err := filepath.Abs(filepath.Join("..", "migrations"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// newTestPostManager returns a PostManager backed by db
+func newTestPostManager(t *testing.T, db DB) PostManager {
+	t.Setenv("POST_PIGEON_NS", "post-pigeon-test")
+	return NewPostManager(db, gcache.New(10).LRU().Build(), Quotas{})
+}
+
+// testKey is a key pair for tests to sign with as an author would
+type testKey struct {
+	private     *ecdsa.PrivateKey
+	publicKey   string
+	fingerprint string
+}
+
+func newTestKey(t *testing.T) testKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	fingerprint, err := Fingerprint(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKey{key, publicKey, fingerprint}
+}
+
+// sign signs message as `openssl dgst -sha1 -sign` would, base64 encoded
+func (k testKey) sign(t *testing.T, message string) string {
+	hash := sha1.Sum([]byte(message))
+	signature, err := ecdsa.SignASN1(rand.Reader, k.private, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(signature)
+}
+
+// createTestPost creates a post titled title, with body, signed by key
+func createTestPost(t *testing.T, pm PostManager, key testKey, title, body string) *model.Post {
+	post, err := pm.CreatePost(model.PostRequest{Title: title, Body: body, PublicKey: key.publicKey, Signature: key.sign(t, body)})
+	if err != nil {
+		t.Fatalf("could not create post %s: %v", title, err)
+	}
+	return post
+}
+
+func TestForeignKeysCascadeDeletes(t *testing.T) {
+	db := newTestDB(t)
+	pm := newTestPostManager(t, db)
+	post := createTestPost(t, pm, newTestKey(t), "post", "---\ntags: [news]\n---\n# post")
+
+	var enabled int
+	if err := db.db.Raw("pragma foreign_keys").Scan(&enabled).Error; err != nil || enabled != 1 {
+		t.Fatalf("expected foreign keys to be enforced: %v", err)
+	}
+
+	if err := db.db.Exec("delete from post where uuid = ?", post.UUID).Error; err != nil {
+		t.Fatal(err)
+	}
+	var content, tags int64
+	db.db.Table("post_content").Where("post_uuid = ?", post.UUID).Count(&content)
+	db.db.Table("post_tag").Where("post_uuid = ?", post.UUID).Count(&tags)
+	if content != 0 || tags != 0 {
+		t.Errorf("expected deleting a post to delete its content and tags, %d content and %d tag rows remain", content, tags)
+	}
+}
+
+func TestMigrationDeletesOrphanedPostContent(t *testing.T) {
+	migration, err := os.ReadFile(filepath.Join(migrationsDir(t), "11_delete_orphaned_post_content.up.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := newTestDBAt(t, 10)
+
+	// orphans were left behind while foreign keys went unenforced
+	err = db.db.Connection(func(conn *gorm.DB) error {
+		statements := []string{
+			"pragma foreign_keys = off",
+			"insert into post (uuid, fingerprint, key, status) values ('kept', 'fp', 'key', 'published')",
+			"insert into post_content (post_uuid, title, html, message) values ('kept', 't', 'h', 'm'), ('orphan', 't', 'h', 'm')",
+			"insert into post_tag (post_uuid, tag) values ('kept', 'news'), ('orphan', 'news')",
+			"pragma foreign_keys = on",
+		}
+		for _, statement := range statements {
+			if err := conn.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = db.db.Exec(string(migration)).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for _, table := range []string{"post_content", "post_tag"} {
+		var uuids []string
+		db.db.Table(table).Order("post_uuid").Pluck("post_uuid", &uuids)
+		if len(uuids) != 1 || uuids[0] != "kept" {
+			t.Errorf("expected only the %s rows of existing posts to be kept got %v", table, uuids)
+		}
+	}
+}
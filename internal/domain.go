@@ -0,0 +1,216 @@
+package internal
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jtanza/post-pigeon/internal/model"
+)
+
+// WellKnownPath is where authors publish the public keys a domain vouches for
+const WellKnownPath = "/.well-known/post-pigeon"
+
+const (
+	DomainPending  = "pending"
+	DomainVerified = "verified"
+	DomainFailed   = "failed"
+	DomainRevoked  = "revoked"
+
+	// domainRecheckInterval is how long a verified domain goes unchecked before we fetch its keys again
+	domainRecheckInterval = 24 * time.Hour
+	// domainPendingTTL is how long we keep trying to verify a claim before giving up on it
+	domainPendingTTL = 72 * time.Hour
+	keyFetchTimeout  = 10 * time.Second
+)
+
+// ErrInvalidDomain is returned when a domain can't be claimed as requested
+var ErrInvalidDomain = errors.New("invalid domain")
+
+var domainPattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}$`)
+
+// KeyFetcher retrieves the document a domain publishes at WellKnownPath
+type KeyFetcher interface {
+	FetchKeys(domain string) (string, error)
+}
+
+// NewKeyFetcher returns the KeyFetcher domains are verified with. Setting POST_PIGEON_WELL_KNOWN_DIR swaps
+// fetching over https for reading files named after each domain from that directory, a local stand-in for testing
+func NewKeyFetcher() KeyFetcher {
+	if dir := os.Getenv("POST_PIGEON_WELL_KNOWN_DIR"); len(dir) > 0 {
+		return DirKeyFetcher{dir}
+	}
+	return NewHTTPKeyFetcher()
+}
+
+// HTTPKeyFetcher fetches keys from https://{domain}/.well-known/post-pigeon. Redirects aren't followed and
+// connections to loopback, private or otherwise internal addresses are refused, so claims can't be used
+// to probe the network we run in
+type HTTPKeyFetcher struct {
+	client *http.Client
+}
+
+func NewHTTPKeyFetcher() HTTPKeyFetcher {
+	dialer := &net.Dialer{Timeout: keyFetchTimeout, Control: refuseInternalAddresses}
+	transport := &http.Transport{
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: keyFetchTimeout,
+	}
+
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   keyFetchTimeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return HTTPKeyFetcher{client}
+}
+
+func (f HTTPKeyFetcher) FetchKeys(domain string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), keyFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+domain+WellKnownPath, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetching keys from %s: unexpected status %d", domain, resp.StatusCode)
+	}
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxFileSize))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func refuseInternalAddresses(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("refusing to connect to internal address %s", host)
+	}
+	return nil
+}
+
+// DirKeyFetcher reads the keys of each domain from a file named after it in dir
+type DirKeyFetcher struct {
+	dir string
+}
+
+func (f DirKeyFetcher) FetchKeys(domain string) (string, error) {
+	b, err := os.ReadFile(filepath.Join(f.dir, filepath.Base(domain)))
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// NormalizeDomain lowercases domain and checks it is a plain host name, e.g. example.com
+func NormalizeDomain(domain string) (string, error) {
+	normalized := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	if len(normalized) > 253 || !domainPattern.MatchString(normalized) {
+		return "", fmt.Errorf("%w: %q is not a domain name", ErrInvalidDomain, domain)
+	}
+	return normalized, nil
+}
+
+// keyListed reports whether any of the PEM encoded public keys in document has the given fingerprint
+func keyListed(document, fingerprint string) bool {
+	rest := []byte(document)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return false
+		}
+
+		if f, err := Fingerprint(string(pem.EncodeToMemory(block))); err == nil && f == fingerprint {
+			return true
+		}
+	}
+}
+
+// DomainVerifier checks the domains authors have claimed against the keys those domains publish
+type DomainVerifier struct {
+	db      DB
+	fetcher KeyFetcher
+}
+
+func NewDomainVerifier(db DB, fetcher KeyFetcher) DomainVerifier {
+	return DomainVerifier{db, fetcher}
+}
+
+// CheckDomains verifies pending claims and re-checks verified domains that are due. Verified domains that
+// no longer list the key they were claimed for are revoked, and claims pending for too long are failed
+func (v DomainVerifier) CheckDomains() error {
+	now := time.Now().UTC()
+	claims, err := v.db.GetDomainsToCheck(now.Add(-domainRecheckInterval))
+	if err != nil {
+		return err
+	}
+
+	for _, claim := range claims {
+		listed := false
+		document, err := v.fetcher.FetchKeys(claim.Domain)
+		if err != nil {
+			slog.Warn("could not fetch domain keys", "domain", claim.Domain, "error", err)
+		} else {
+			listed = keyListed(document, claim.Fingerprint)
+		}
+
+		claim.CheckedAt = &now
+		switch {
+		case listed:
+			if claim.Status != DomainVerified {
+				claim.VerifiedAt = &now
+			}
+			claim.Status = DomainVerified
+		case claim.Status == DomainVerified:
+			claim.Status = DomainRevoked
+			slog.Info("revoked domain verification", "domain", claim.Domain, "fingerprint", claim.Fingerprint)
+		case claim.ClaimedAt.Before(now.Add(-domainPendingTTL)):
+			claim.Status = DomainFailed
+		}
+
+		if err = v.db.SaveDomainVerification(claim); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newDomainStatement describes a domain claim to clients
+func newDomainStatement(claim model.DomainVerification) model.DomainStatement {
+	return model.DomainStatement{
+		Domain:      claim.Domain,
+		Fingerprint: claim.Fingerprint,
+		Status:      claim.Status,
+		CheckedAt:   claim.CheckedAt,
+		VerifiedAt:  claim.VerifiedAt,
+	}
+}
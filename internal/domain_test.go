@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jtanza/post-pigeon/internal/model"
+)
+
+const domainTestKey = "-----BEGIN PUBLIC KEY-----\nMIGbMBAGByqGSM49AgEGBSuBBAAjA4GGAAQAdI8T8Vfccs6rWACR3b5o3MuVkYjf\ngN2nnYAXYNC4fIVWgyfEeTYIGIjLxEB9BLquMld4Je+1vITaNQWfuRTD2HcBax6N\nRwxwcNGqwoJNWpCry9AXxRiDACkks9I2f08BIIHlOCLnPUfIWrASmuNGhyWtSUtA\nJrEKBzI+y/fyWp7z09U=\n-----END PUBLIC KEY-----"
+
+func TestNormalizeDomain(t *testing.T) {
+	domain, err := NormalizeDomain(" Blog.Example.com. ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if domain != "blog.example.com" {
+		t.Errorf("expected normalized domain got %s", domain)
+	}
+
+	for _, invalid := range []string{"localhost", "127.0.0.1", "example.com:8080", "https://example.com", "-bad.example.com"} {
+		if _, err = NormalizeDomain(invalid); !errors.Is(err, ErrInvalidDomain) {
+			t.Errorf("expected %q to be rejected, got %v", invalid, err)
+		}
+	}
+}
+
+func TestKeyListed(t *testing.T) {
+	fingerprint, err := Fingerprint(domainTestKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	document := "# keys of example.com\n" + domainTestKey + "\n"
+	if !keyListed(document, fingerprint) {
+		t.Error("expected key to be found in document")
+	}
+	if keyListed("no keys here", fingerprint) {
+		t.Error("expected no key to be found in document")
+	}
+}
+
+func TestDirKeyFetcher(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "example.com"), []byte(domainTestKey), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fetcher := DirKeyFetcher{dir}
+	if document, err := fetcher.FetchKeys("example.com"); err != nil || document != domainTestKey {
+		t.Errorf("expected keys of example.com to be read, got %q %v", document, err)
+	}
+	if _, err := fetcher.FetchKeys("example.org"); err == nil {
+		t.Error("expected domains without a file to fail")
+	}
+}
+
+func TestCheckDomainsKeepsReclaimedDomainsPending(t *testing.T) {
+	db := newTestDB(t)
+	pm := newTestPostManager(t, db)
+	key := newTestKey(t)
+	claim := model.DomainRequest{Domain: "example.com", PublicKey: key.publicKey, Signature: key.sign(t, "example.com")}
+	if _, err := pm.ClaimDomain(claim); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first claim was made long ago and failed
+	longAgo := time.Now().Add(-2 * domainPendingTTL)
+	if err := db.db.Exec("update domain_verification set status = ?, created_at = ?, claimed_at = ?", DomainFailed, longAgo, longAgo).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pm.ClaimDomain(claim); err != nil {
+		t.Fatalf("expected a failed claim to be made again: %v", err)
+	}
+
+	if err := NewDomainVerifier(db, DirKeyFetcher{t.TempDir()}).CheckDomains(); err != nil {
+		t.Fatal(err)
+	}
+	reclaimed, err := db.GetDomainVerification("example.com", key.fingerprint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reclaimed.Status != DomainPending {
+		t.Errorf("expected a claim made again to stay pending while it's checked got %s", reclaimed.Status)
+	}
+}
@@ -0,0 +1,43 @@
+package internal
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"log/slog"
+	"os"
+	"time"
+)
+
+const (
+	PostPublished = "published"
+	PostDraft     = "draft"
+	PostScheduled = "scheduled"
+
+	defaultDraftTTL = 7 * 24 * time.Hour
+)
+
+// DraftTTL is how long an unpublished draft is kept before it's reaped, configured through POST_PIGEON_DRAFT_TTL
+// as a duration, e.g. 72h
+func DraftTTL() time.Duration {
+	raw := os.Getenv("POST_PIGEON_DRAFT_TTL")
+	if len(raw) == 0 {
+		return defaultDraftTTL
+	}
+
+	ttl, err := time.ParseDuration(raw)
+	if err != nil || ttl <= 0 {
+		slog.Warn("invalid POST_PIGEON_DRAFT_TTL, keeping drafts for the default", "value", raw, "default", defaultDraftTTL)
+		return defaultDraftTTL
+	}
+	return ttl
+}
+
+// newPreviewToken returns the secret a draft can be previewed with. Unlike post uuids, which are derived
+// from the key and title of a post, preview tokens can't be guessed
+func newPreviewToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,161 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/jtanza/post-pigeon/internal/model"
+)
+
+const (
+	sha256Prefix = "SHA256:"
+	// visualHashSymbols is the number of words or emoji in a visual hash. Each stands for 6 bits of the
+	// fingerprint, so a visual hash covers its first 6 bytes
+	visualHashSymbols = 8
+	visualHashBytes   = visualHashSymbols * 6 / 8
+)
+
+var fingerprintWords = [64]string{
+	"acid", "amber", "anchor", "apple", "arrow", "atlas", "badge", "bamboo",
+	"basil", "beacon", "birch", "bison", "blaze", "bloom", "brick", "cabin",
+	"cactus", "candle", "canyon", "cedar", "cherry", "cider", "clover", "cobalt",
+	"comet", "coral", "cotton", "crane", "crystal", "daisy", "delta", "denim",
+	"ember", "falcon", "fern", "fjord", "flint", "garnet", "ginger", "glacier",
+	"harbor", "hazel", "honey", "indigo", "island", "jasper", "juniper", "kettle",
+	"lagoon", "lemon", "lotus", "maple", "marble", "meadow", "nectar", "nickel",
+	"oasis", "olive", "orbit", "pebble", "pepper", "quartz", "raven", "saffron",
+}
+
+var fingerprintEmoji = [64]rune{
+	'🐶', '🐱', '🐭', '🐹', '🐰', '🦊', '🐻', '🐼',
+	'🐨', '🐯', '🦁', '🐮', '🐷', '🐸', '🐵', '🐔',
+	'🐧', '🐦', '🐤', '🦆', '🦅', '🦉', '🦇', '🐺',
+	'🐗', '🐴', '🦄', '🐝', '🐛', '🦋', '🐌', '🐞',
+	'🐜', '🦗', '🦂', '🐢', '🐍', '🦎', '🦖', '🦕',
+	'🐙', '🦑', '🦐', '🦞', '🦀', '🐡', '🐠', '🐟',
+	'🐬', '🐳', '🐋', '🦈', '🐊', '🐅', '🐆', '🦓',
+	'🦍', '🦧', '🐘', '🦛', '🦏', '🐪', '🐫', '🦒',
+}
+
+// FormatFingerprint renders fingerprint in each of the formats we accept it in. Besides the canonical URL safe
+// base64 there are the OpenSSH style SHA256:..., colon separated hex, and word and emoji visual hashes meant to be
+// compared at a glance. Visual hashes only cover the start of a fingerprint, and shouldn't be relied on alone
+func FormatFingerprint(fingerprint string) (model.FingerprintFormats, error) {
+	sum, err := base64.URLEncoding.DecodeString(fingerprint)
+	if err != nil || len(sum) == 0 {
+		return model.FingerprintFormats{}, fmt.Errorf("invalid fingerprint %q", fingerprint)
+	}
+
+	hexBytes := make([]string, len(sum))
+	for i, b := range sum {
+		hexBytes[i] = hex.EncodeToString([]byte{b})
+	}
+
+	indexes := visualHashIndexes(sum)
+	words := make([]string, len(indexes))
+	emoji := make([]rune, len(indexes))
+	for i, index := range indexes {
+		words[i] = fingerprintWords[index]
+		emoji[i] = fingerprintEmoji[index]
+	}
+
+	return model.FingerprintFormats{
+		Fingerprint: fingerprint,
+		SHA256:      sha256Prefix + base64.RawStdEncoding.EncodeToString(sum),
+		Hex:         strings.Join(hexBytes, ":"),
+		Words:       strings.Join(words, "-"),
+		Emoji:       string(emoji),
+	}, nil
+}
+
+// parseFingerprint reads a fingerprint given in any of the formats of FormatFingerprint. It returns either the
+// canonical fingerprint, or for visual hashes, the canonical encoding of the prefix of the fingerprint they cover
+func parseFingerprint(s string) (string, bool, error) {
+	s = strings.TrimSpace(s)
+
+	if sum, err := base64.URLEncoding.DecodeString(s); err == nil && len(sum) == sha256.Size {
+		return s, false, nil
+	}
+
+	if encoded, found := strings.CutPrefix(s, sha256Prefix); found {
+		sum, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(encoded, "="))
+		if err != nil || len(sum) != sha256.Size {
+			return "", false, errors.New("invalid SHA256 fingerprint")
+		}
+		return base64.URLEncoding.EncodeToString(sum), false, nil
+	}
+
+	if sum, err := hex.DecodeString(strings.ReplaceAll(s, ":", "")); err == nil && len(sum) == sha256.Size {
+		return base64.URLEncoding.EncodeToString(sum), false, nil
+	}
+
+	if indexes, ok := parseVisualHash(s); ok {
+		return base64.RawURLEncoding.EncodeToString(visualHashPrefix(indexes)), true, nil
+	}
+
+	return "", false, errors.New("unrecognized fingerprint format")
+}
+
+// visualHashIndexes splits the first visualHashBytes of sum into 6 bit indexes into our word and emoji lists
+func visualHashIndexes(sum []byte) []int {
+	buf := make([]byte, 8)
+	copy(buf[2:], sum[:min(len(sum), visualHashBytes)])
+	v := binary.BigEndian.Uint64(buf)
+
+	indexes := make([]int, visualHashSymbols)
+	for i := range indexes {
+		indexes[i] = int(v>>(6*(visualHashSymbols-1-i))) & 63
+	}
+	return indexes
+}
+
+// visualHashPrefix reverses visualHashIndexes, returning the bytes the indexes were read from
+func visualHashPrefix(indexes []int) []byte {
+	var v uint64
+	for _, index := range indexes {
+		v = v<<6 | uint64(index)
+	}
+
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, v)
+	return buf[2:]
+}
+
+func parseVisualHash(s string) ([]int, bool) {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return r == '-' || r == ' ' || r == '.'
+	})
+	if len(words) == visualHashSymbols {
+		indexes := make([]int, 0, visualHashSymbols)
+		for _, w := range words {
+			index := slices.Index(fingerprintWords[:], w)
+			if index == -1 {
+				break
+			}
+			indexes = append(indexes, index)
+		}
+		if len(indexes) == visualHashSymbols {
+			return indexes, true
+		}
+	}
+
+	runes := []rune(strings.ReplaceAll(s, " ", ""))
+	if len(runes) != visualHashSymbols {
+		return nil, false
+	}
+	indexes := make([]int, 0, visualHashSymbols)
+	for _, r := range runes {
+		index := slices.Index(fingerprintEmoji[:], r)
+		if index == -1 {
+			return nil, false
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes, true
+}
@@ -0,0 +1,66 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+const testFingerprint = "d_uUMLLYk4TrZ8tbPG82AjulQBcPBoI_TF6n-yX41KQ="
+
+func TestFormatFingerprint(t *testing.T) {
+	formats, err := FormatFingerprint(testFingerprint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(formats.SHA256, "SHA256:") || strings.HasSuffix(formats.SHA256, "=") {
+		t.Errorf("expected an unpadded OpenSSH style fingerprint got %s", formats.SHA256)
+	}
+	if len(formats.Hex) != 32*3-1 || strings.Count(formats.Hex, ":") != 31 {
+		t.Errorf("expected colon separated hex got %s", formats.Hex)
+	}
+	if len(strings.Split(formats.Words, "-")) != visualHashSymbols || len([]rune(formats.Emoji)) != visualHashSymbols {
+		t.Errorf("expected visual hashes of %d symbols got %s %s", visualHashSymbols, formats.Words, formats.Emoji)
+	}
+
+	if _, err = FormatFingerprint("not a fingerprint"); err == nil {
+		t.Error("expected invalid fingerprints to be rejected")
+	}
+}
+
+func TestParseFingerprintFormats(t *testing.T) {
+	formats, err := FormatFingerprint(testFingerprint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []string{formats.Fingerprint, formats.SHA256, formats.Hex, strings.ReplaceAll(formats.Hex, ":", "")} {
+		fingerprint, prefix, err := parseFingerprint(s)
+		if err != nil || prefix || fingerprint != testFingerprint {
+			t.Errorf("expected %s to parse to %s got %s %v", s, testFingerprint, fingerprint, err)
+		}
+	}
+
+	for _, s := range []string{formats.Words, strings.ToUpper(strings.ReplaceAll(formats.Words, "-", " ")), formats.Emoji} {
+		fingerprint, prefix, err := parseFingerprint(s)
+		if err != nil || !prefix || !strings.HasPrefix(testFingerprint, fingerprint) {
+			t.Errorf("expected %s to parse to a prefix of %s got %s %v", s, testFingerprint, fingerprint, err)
+		}
+	}
+
+	if _, _, err = parseFingerprint("acid-amber-anchor"); err == nil {
+		t.Error("expected incomplete visual hashes to be rejected")
+	}
+}
+
+func TestVisualHashSymbolsAreDistinct(t *testing.T) {
+	words := make(map[string]bool)
+	emoji := make(map[rune]bool)
+	for i := range fingerprintWords {
+		words[fingerprintWords[i]] = true
+		emoji[fingerprintEmoji[i]] = true
+	}
+	if len(words) != len(fingerprintWords) || len(emoji) != len(fingerprintEmoji) {
+		t.Errorf("expected every word and emoji to be distinct, got %d words and %d emoji", len(words), len(emoji))
+	}
+}
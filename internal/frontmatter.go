@@ -0,0 +1,155 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	frontMatterDelimiter = "---"
+	maxTags              = 10
+	maxTagLength         = 32
+	maxSlugLength        = 64
+)
+
+// ErrInvalidPost is returned when the content of a post can't be published as is
+var ErrInvalidPost = errors.New("invalid post")
+
+var invalidSlugChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// frontMatter holds the metadata an author can declare at the very top of a post, between two lines of ---
+//
+//	---
+//	tags: recipes, baking
+//	slug: sourdough
+//	publish_at: 2024-06-01T09:00:00Z
+//	---
+//
+// Being part of the post body, front matter is covered by the signature of the post like everything else
+type frontMatter struct {
+	Tags      []string
+	Slug      string
+	PublishAt *time.Time
+}
+
+// splitFrontMatter separates any front matter from the markdown content of message
+func splitFrontMatter(message string) (string, string, bool) {
+	normalized := strings.ReplaceAll(message, "\r\n", "\n")
+	if !strings.HasPrefix(normalized, frontMatterDelimiter+"\n") {
+		return "", message, false
+	}
+
+	rest := normalized[len(frontMatterDelimiter)+1:]
+	header, content, found := strings.Cut(rest, "\n"+frontMatterDelimiter+"\n")
+	if !found {
+		header, found = strings.CutSuffix(rest, "\n"+frontMatterDelimiter)
+		if !found {
+			return "", message, false
+		}
+	}
+
+	return header, content, true
+}
+
+// parseFrontMatter reads the front matter declared in message, if there is any
+func parseFrontMatter(message string) (frontMatter, error) {
+	var fm frontMatter
+
+	header, _, found := splitFrontMatter(message)
+	if !found {
+		return fm, nil
+	}
+
+	err := forEachField(header, ErrInvalidPost, func(key, value string) error {
+		switch key {
+		case "tags":
+			tags, err := parseTags(value)
+			if err != nil {
+				return err
+			}
+			fm.Tags = tags
+		case "slug":
+			slug, err := parseSlug(value)
+			if err != nil {
+				return err
+			}
+			fm.Slug = slug
+		case "publish_at":
+			publishAt, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return fmt.Errorf("%w: publish_at must be a RFC 3339 timestamp, e.g. 2024-06-01T09:00:00Z", ErrInvalidPost)
+			}
+			publishAt = publishAt.UTC()
+			fm.PublishAt = &publishAt
+		default:
+			return fmt.Errorf("%w: unknown front matter field %q", ErrInvalidPost, key)
+		}
+		return nil
+	})
+
+	return fm, err
+}
+
+// forEachField calls fn with the lowercased key and trimmed value of each key: value line in text,
+// skipping blank lines. It stops at, and returns, the first error. Malformed lines are reported wrapping invalid
+func forEachField(text string, invalid error, fn func(key, value string) error) error {
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			return fmt.Errorf("%w: line %q is not of the form key: value", invalid, line)
+		}
+
+		if err := fn(strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseTags splits a comma separated list of tags, normalizing each
+func parseTags(list string) ([]string, error) {
+	tags := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, t := range strings.Split(list, ",") {
+		tag := Slugify(t)
+		if len(tag) == 0 || seen[tag] {
+			continue
+		}
+		if len(tag) > maxTagLength {
+			return nil, fmt.Errorf("%w: tag %s is longer than %d characters", ErrInvalidPost, tag, maxTagLength)
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+
+	if len(tags) > maxTags {
+		return nil, fmt.Errorf("%w: posts can have at most %d tags", ErrInvalidPost, maxTags)
+	}
+	return tags, nil
+}
+
+func parseSlug(value string) (string, error) {
+	slug := Slugify(value)
+	if len(slug) == 0 {
+		return "", fmt.Errorf("%w: slug %q has no letters or numbers", ErrInvalidPost, value)
+	}
+	if len(slug) > maxSlugLength {
+		return "", fmt.Errorf("%w: slug %s is longer than %d characters", ErrInvalidPost, slug, maxSlugLength)
+	}
+	return slug, nil
+}
+
+// Slugify lowercases s and reduces it to letters, numbers and dashes, e.g. "Home Cooking" becomes home-cooking.
+// Tags, slugs and handles are all normalized this way
+func Slugify(s string) string {
+	normalized := strings.ToLower(strings.TrimSpace(s))
+	normalized = invalidSlugChars.ReplaceAllString(normalized, "-")
+	return strings.Trim(normalized, "-")
+}
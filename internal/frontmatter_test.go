@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseFrontMatterTags(t *testing.T) {
+	fm, err := parseFrontMatter("---\ntags: Go, Home Cooking, go\n---\n# Title")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"go", "home-cooking"}
+	if !reflect.DeepEqual(fm.Tags, expected) {
+		t.Errorf("tags do not match expected\n got: %v wanted: %v", fm.Tags, expected)
+	}
+}
+
+func TestParseFrontMatterRejectsUnknownFields(t *testing.T) {
+	if _, err := parseFrontMatter("---\ntagz: go\n---\n# Title"); !errors.Is(err, ErrInvalidPost) {
+		t.Errorf("expected unknown fields to be rejected, got %v", err)
+	}
+}
+
+func TestSplitFrontMatter(t *testing.T) {
+	_, content, found := splitFrontMatter("---\r\ntags: go\r\n---\r\n# Title")
+	if !found || content != "# Title" {
+		t.Errorf("expected front matter to be split from content, got %q", content)
+	}
+
+	message := "# Title\n---\ntags: go\n---\n"
+	if _, content, found = splitFrontMatter(message); found || content != message {
+		t.Error("front matter should only be read from the very top of a post")
+	}
+
+	message = "---\nno closing delimiter"
+	if _, content, found = splitFrontMatter(message); found || content != message {
+		t.Error("unterminated front matter should be left as content")
+	}
+}
+
+func TestParseFrontMatterSlug(t *testing.T) {
+	fm, err := parseFrontMatter("---\nslug: My First Post!\n---\n# Title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fm.Slug != "my-first-post" {
+		t.Errorf("expected normalized slug got %s", fm.Slug)
+	}
+
+	if _, err = parseFrontMatter("---\nslug: !!!\n---\n# Title"); !errors.Is(err, ErrInvalidPost) {
+		t.Errorf("expected empty slugs to be rejected, got %v", err)
+	}
+}
+
+func TestParseFrontMatterPublishAt(t *testing.T) {
+	fm, err := parseFrontMatter("---\npublish_at: 2024-06-01T11:00:00+02:00\n---\n# Title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC)
+	if fm.PublishAt == nil || !fm.PublishAt.Equal(expected) || fm.PublishAt.Location() != time.UTC {
+		t.Errorf("expected publish_at of %s got %v", expected, fm.PublishAt)
+	}
+
+	if _, err = parseFrontMatter("---\npublish_at: tomorrow\n---\n# Title"); !errors.Is(err, ErrInvalidPost) {
+		t.Errorf("expected malformed timestamps to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,177 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jtanza/post-pigeon/internal/model"
+	"github.com/jtanza/post-pigeon/migrations"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	readinessTimeout   = 2 * time.Second
+	defaultDrainPeriod = 5 * time.Second
+)
+
+// Health answers the probes of load balancers and process supervisors
+type Health struct {
+	db          DB
+	postManager PostManager
+	draining    *atomic.Bool
+}
+
+func NewHealth(db DB, postManager PostManager) Health {
+	return Health{db, postManager, &atomic.Bool{}}
+}
+
+// Drain fails every readiness check from now on, so that traffic is routed elsewhere ahead of shutting down
+func (h Health) Drain() {
+	h.draining.Store(true)
+}
+
+// DrainPeriod is how long to keep serving after draining, giving load balancers time to notice we're no longer
+// ready before we stop accepting connections. Configured through POST_PIGEON_DRAIN_PERIOD as a duration, e.g. 10s
+func DrainPeriod() time.Duration {
+	raw := os.Getenv("POST_PIGEON_DRAIN_PERIOD")
+	if len(raw) == 0 {
+		return defaultDrainPeriod
+	}
+
+	period, err := time.ParseDuration(raw)
+	if err != nil || period < 0 {
+		slog.Warn("invalid POST_PIGEON_DRAIN_PERIOD, draining for the default", "value", raw, "default", defaultDrainPeriod)
+		return defaultDrainPeriod
+	}
+	return period
+}
+
+// Ready runs every readiness check, returning the outcome of each. The app is ready when they all pass
+func (h Health) Ready(ctx context.Context) model.Readiness {
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+
+	readiness := model.Readiness{Ready: true, Checks: map[string]string{}}
+	check := func(name string, err error) {
+		if err != nil {
+			readiness.Ready = false
+			readiness.Checks[name] = err.Error()
+		} else {
+			readiness.Checks[name] = "ok"
+		}
+	}
+
+	if h.draining.Load() {
+		check("shutdown", errors.New("draining"))
+	}
+	check("db", h.db.Ping(ctx))
+	check("migrations", h.checkMigrations())
+	check("templates", checkTemplates())
+	if h.postManager.cache == nil {
+		check("cache", errors.New("uninitialised"))
+	} else {
+		check("cache", nil)
+	}
+
+	return readiness
+}
+
+// checkMigrations ensures the db schema is at the version of the latest migration
+func (h Health) checkMigrations() error {
+	latest, err := latestMigration()
+	if err != nil {
+		return err
+	}
+
+	version, err := h.db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if version != latest {
+		return fmt.Errorf("schema at version %d, latest migration is %d", version, latest)
+	}
+	return nil
+}
+
+// latestMigration returns the number of the latest migration, which the schema version is set to once it's applied
+func latestMigration() (int, error) {
+	return latestMigrationIn(migrations.FS)
+}
+
+// latestMigrationIn returns the number of the latest up migration in migrations
+func latestMigrationIn(migrations fs.FS) (int, error) {
+	files, err := fs.Glob(migrations, "*.up.sql")
+	if err != nil {
+		return 0, err
+	}
+
+	latest := 0
+	for _, file := range files {
+		number, _, _ := strings.Cut(file, "_")
+		if n, err := strconv.Atoi(number); err == nil && n > latest {
+			latest = n
+		}
+	}
+	if latest == 0 {
+		return 0, errors.New("no migrations found")
+	}
+	return latest, nil
+}
+
+// checkTemplates ensures the templates were loaded at startup
+func checkTemplates() error {
+	if templates == nil {
+		return errors.New("templates not loaded")
+	}
+	return nil
+}
+
+// BuildInfo describes the build of the running binary, as recorded by the go toolchain
+func BuildInfo() model.BuildInfo {
+	info := model.BuildInfo{}
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	info.Module = build.Main.Path
+	info.Version = build.Main.Version
+	info.GoVersion = build.GoVersion
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			info.Revision = setting.Value
+		case "vcs.time":
+			info.RevisionTime = setting.Value
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		}
+	}
+	return info
+}
+
+func (h Health) getHealth(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (h Health) getReadiness(c echo.Context) error {
+	readiness := h.Ready(c.Request().Context())
+	if !readiness.Ready {
+		return c.JSON(http.StatusServiceUnavailable, readiness)
+	}
+	return c.JSON(http.StatusOK, readiness)
+}
+
+func (h Health) getVersion(c echo.Context) error {
+	return c.JSON(http.StatusOK, BuildInfo())
+}
@@ -0,0 +1,88 @@
+package internal
+
+import (
+	"os"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLatestMigration(t *testing.T) {
+	migrations := fstest.MapFS{}
+	for _, name := range []string{"1_init.up.sql", "2_tags.up.sql", "10_status.up.sql", "10_status.down.sql", "11_next.down.sql"} {
+		migrations[name] = &fstest.MapFile{}
+	}
+
+	latest, err := latestMigrationIn(migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest != 10 {
+		t.Errorf("expected latest migration to be 10 got %d", latest)
+	}
+}
+
+func TestLatestMigrationEmbedded(t *testing.T) {
+	expected, err := latestMigrationIn(os.DirFS(migrationsDir(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the binaries mustn't need to be run from the root of the repo to find the migrations
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	latest, err := latestMigration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest != expected {
+		t.Errorf("expected the latest embedded migration to be %d got %d", expected, latest)
+	}
+}
+
+func TestCheckTemplates(t *testing.T) {
+	loaded := templates
+	t.Cleanup(func() { templates = loaded })
+
+	templates = nil
+	if err := checkTemplates(); err == nil {
+		t.Error("expected templates that weren't loaded to fail the check")
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(".."); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	if err = LoadTemplates(); err != nil {
+		t.Fatalf("could not load templates: %v", err)
+	}
+	if err = checkTemplates(); err != nil {
+		t.Errorf("expected loaded templates to pass the check got %v", err)
+	}
+	if page, err := errorHTML("not found", 404); err != nil || len(page) == 0 {
+		t.Errorf("expected the error page to render from the loaded templates: %v", err)
+	}
+}
+
+func TestDrainPeriod(t *testing.T) {
+	t.Setenv("POST_PIGEON_DRAIN_PERIOD", "10s")
+	if period := DrainPeriod(); period.Seconds() != 10 {
+		t.Errorf("expected a drain period of 10s got %s", period)
+	}
+
+	t.Setenv("POST_PIGEON_DRAIN_PERIOD", "soon")
+	if period := DrainPeriod(); period != defaultDrainPeriod {
+		t.Errorf("expected invalid drain periods to fall back to the default, got %s", period)
+	}
+}
@@ -0,0 +1,137 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jtanza/post-pigeon/internal/model"
+)
+
+// ExpiredPostsJob reaps posts past their expiration
+func ExpiredPostsJob(pm PostManager) Job {
+	return Job{
+		Name:     "expired-posts",
+		Interval: 5 * time.Minute,
+		Jitter:   30 * time.Second,
+		Run: func(ctx context.Context) (string, error) {
+			deleted, err := pm.ReapExpiredPosts()
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("deleted %d expired posts", deleted), nil
+		},
+	}
+}
+
+// ScheduledPostsJob flips scheduled posts whose time has come to published. Scheduled posts are public from their
+// publish_at regardless, this keeps their status in line
+func ScheduledPostsJob(db DB) Job {
+	return Job{
+		Name:     "scheduled-posts",
+		Interval: time.Minute,
+		Jitter:   5 * time.Second,
+		Run: func(ctx context.Context) (string, error) {
+			published, err := db.PublishScheduledPosts(model.AuditEntry{Action: AuditPublishPost, Actor: actorSystem, Details: PostPublished})
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("published %d scheduled posts", published), nil
+		},
+	}
+}
+
+// ExpiredDraftsJob reaps drafts left unpublished for longer than DraftTTL
+func ExpiredDraftsJob(db DB) Job {
+	return Job{
+		Name:     "expired-drafts",
+		Interval: time.Hour,
+		Jitter:   5 * time.Minute,
+		Run: func(ctx context.Context) (string, error) {
+			deleted, err := db.DeleteExpiredDrafts(time.Now().UTC().Add(-DraftTTL()), model.AuditEntry{Action: AuditExpireDraft, Actor: actorSystem})
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("deleted %d expired drafts", deleted), nil
+		},
+	}
+}
+
+// DomainsJob checks the domains claimed by authors, see DomainVerifier
+func DomainsJob(verifier DomainVerifier) Job {
+	return Job{
+		Name:     "domains",
+		Interval: 10 * time.Minute,
+		Jitter:   time.Minute,
+		Run: func(ctx context.Context) (string, error) {
+			if err := verifier.CheckDomains(); err != nil {
+				return "", err
+			}
+			return "checked claimed domains", nil
+		},
+	}
+}
+
+// RateLimitsJob drops the counts the db rate limit store keeps of windows that have ended
+func RateLimitsJob(db DB) Job {
+	return Job{
+		Name:     "rate-limits",
+		Interval: 10 * time.Minute,
+		Jitter:   time.Minute,
+		Run: func(ctx context.Context) (string, error) {
+			deleted, err := db.WithContext(ctx).DeleteEndedRateLimits(time.Now())
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("deleted %d ended rate limit windows", deleted), nil
+		},
+	}
+}
+
+// BlocklistJob reloads the blocklist, picking up the changes made to it through other instances
+func BlocklistJob(pm PostManager) Job {
+	return Job{
+		Name:     "blocklist",
+		Interval: 30 * time.Second,
+		Jitter:   5 * time.Second,
+		Run: func(ctx context.Context) (string, error) {
+			entries, err := pm.ReloadBlocklist()
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("loaded %d blocklist entries", entries), nil
+		},
+	}
+}
+
+// AuditLogJob drops the entries of the audit log past AuditRetention
+func AuditLogJob(pm PostManager) Job {
+	return Job{
+		Name:     "audit-log",
+		Interval: 24 * time.Hour,
+		Jitter:   time.Hour,
+		Run: func(ctx context.Context) (string, error) {
+			deleted, err := pm.WithContext(ctx).PruneAuditLog()
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("deleted %d audit entries past retention", deleted), nil
+		},
+	}
+}
+
+// BackupJob backs up the db to BackupDir, keeping the BackupKeep latest backups
+func BackupJob(db DB) Job {
+	return Job{
+		Name:     "backup",
+		Interval: 24 * time.Hour,
+		Jitter:   time.Hour,
+		Run: func(ctx context.Context) (string, error) {
+			path, err := Backup(ctx, db, BackupDir(), BackupKeep())
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("backed up to %s", path), nil
+		},
+	}
+}
@@ -0,0 +1,239 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"gopkg.in/natefinch/lumberjack.v2"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+const (
+	defaultLogOutput     = "log/postpigeon.log"
+	defaultLogMaxSize    = 100
+	defaultLogMaxBackups = 10
+
+	// slowQueryThreshold is how long a query runs for before it's logged as a warning
+	slowQueryThreshold = 200 * time.Millisecond
+)
+
+type requestIDKey struct{}
+
+// Fatal logs msg as an error and exits, for the failures the app can't run past
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// NewLogger returns the logger everything is logged through, configured from the environment:
+//
+//	POST_PIGEON_LOG_FORMAT       json, the default, or text
+//	POST_PIGEON_LOG_LEVEL        debug, info, the default, warn or error
+//	POST_PIGEON_LOG_OUTPUT       stdout, stderr or a file, log/postpigeon.log by default
+//	POST_PIGEON_LOG_MAX_SIZE     megabytes a log file grows to before it's rotated, 100 by default
+//	POST_PIGEON_LOG_MAX_BACKUPS  rotated log files kept, 10 by default
+//
+// The returned io.Closer closes the log file, if there is one
+func NewLogger() (*slog.Logger, io.Closer, error) {
+	var level slog.Level
+	if raw := os.Getenv("POST_PIGEON_LOG_LEVEL"); len(raw) > 0 {
+		if err := level.UnmarshalText([]byte(raw)); err != nil {
+			return nil, nil, fmt.Errorf("invalid POST_PIGEON_LOG_LEVEL %q", raw)
+		}
+	}
+
+	output, err := logOutput()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch format := strings.ToLower(os.Getenv("POST_PIGEON_LOG_FORMAT")); format {
+	case "", "json":
+		handler = slog.NewJSONHandler(output, options)
+	case "text":
+		handler = slog.NewTextHandler(output, options)
+	default:
+		return nil, nil, fmt.Errorf("invalid POST_PIGEON_LOG_FORMAT %q", format)
+	}
+
+	return slog.New(contextHandler{handler}), output, nil
+}
+
+func logOutput() (io.WriteCloser, error) {
+	output := os.Getenv("POST_PIGEON_LOG_OUTPUT")
+	switch output {
+	case "stdout":
+		return nopCloser{os.Stdout}, nil
+	case "stderr":
+		return nopCloser{os.Stderr}, nil
+	case "":
+		output = defaultLogOutput
+	}
+
+	maxSize, err := envInt("POST_PIGEON_LOG_MAX_SIZE", defaultLogMaxSize)
+	if err != nil {
+		return nil, err
+	}
+	maxBackups, err := envInt("POST_PIGEON_LOG_MAX_BACKUPS", defaultLogMaxBackups)
+	if err != nil {
+		return nil, err
+	}
+
+	return &lumberjack.Logger{Filename: output, MaxSize: maxSize, MaxBackups: maxBackups}, nil
+}
+
+func envInt(name string, fallback int) (int, error) {
+	raw := os.Getenv(name)
+	if len(raw) == 0 {
+		return fallback, nil
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid %s %q", name, raw)
+	}
+	return value, nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// contextHandler adds the id of the request a record is logged on behalf of, if any, to the record
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestID(ctx); len(id) > 0 {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// RequestID returns the id of the request ctx belongs to, or an empty string outside of requests
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestIDMiddleware tags every request with an id, reusing the X-Request-Id header of requests that have one.
+// The id is returned in the response, and carried by the request context to whatever's logged on its behalf
+func requestIDMiddleware() echo.MiddlewareFunc {
+	return middleware.RequestIDWithConfig(middleware.RequestIDConfig{
+		RequestIDHandler: func(c echo.Context, id string) {
+			c.SetRequest(c.Request().WithContext(context.WithValue(c.Request().Context(), requestIDKey{}, id)))
+		},
+	})
+}
+
+// requestLogger logs every request once it's been served, server errors as errors. Health probes go unlogged
+func requestLogger() echo.MiddlewareFunc {
+	return middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
+		Skipper: func(c echo.Context) bool {
+			return c.Path() == "/healthz" || c.Path() == "/readyz"
+		},
+		HandleError:  true,
+		LogMethod:    true,
+		LogURI:       true,
+		LogRoutePath: true,
+		LogStatus:    true,
+		LogLatency:   true,
+		LogRemoteIP:  true,
+		LogUserAgent: true,
+		LogError:     true,
+		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
+			level := slog.LevelInfo
+			if v.Status >= 500 {
+				level = slog.LevelError
+			}
+
+			attrs := []slog.Attr{
+				slog.String("method", v.Method),
+				slog.String("uri", v.URI),
+				slog.String("route", v.RoutePath),
+				slog.Int("status", v.Status),
+				slog.Duration("latency", v.Latency),
+				slog.String("remote_ip", v.RemoteIP),
+				slog.String("user_agent", v.UserAgent),
+			}
+			if v.Error != nil {
+				attrs = append(attrs, slog.String("error", v.Error.Error()))
+			}
+
+			slog.LogAttrs(c.Request().Context(), level, "request", attrs...)
+			return nil
+		},
+	})
+}
+
+// gormLogger logs the queries gorm runs through slog: failed queries as errors, slow ones as warnings and
+// everything else at the debug level
+type gormLogger struct {
+	level gormlogger.LogLevel
+}
+
+func (l gormLogger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
+	l.level = level
+	return l
+}
+
+func (l gormLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= gormlogger.Info {
+		slog.InfoContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l gormLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= gormlogger.Warn {
+		slog.WarnContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l gormLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= gormlogger.Error {
+		slog.ErrorContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l gormLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	if l.level <= gormlogger.Silent {
+		return
+	}
+
+	elapsed := time.Since(begin)
+	switch {
+	case err != nil && l.level >= gormlogger.Error && !errors.Is(err, gorm.ErrRecordNotFound):
+		sql, rows := fc()
+		slog.ErrorContext(ctx, "query failed", "error", err, "sql", sql, "rows", rows, "duration", elapsed)
+	case elapsed > slowQueryThreshold && l.level >= gormlogger.Warn:
+		sql, rows := fc()
+		slog.WarnContext(ctx, "slow query", "sql", sql, "rows", rows, "duration", elapsed)
+	case l.level >= gormlogger.Info && slog.Default().Enabled(ctx, slog.LevelDebug):
+		sql, rows := fc()
+		slog.DebugContext(ctx, "query", "sql", sql, "rows", rows, "duration", elapsed)
+	}
+}
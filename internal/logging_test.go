@@ -0,0 +1,46 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestContextHandlerAddsRequestID(t *testing.T) {
+	var b bytes.Buffer
+	logger := slog.New(contextHandler{slog.NewJSONHandler(&b, nil)}).With("component", "test")
+
+	ctx := context.WithValue(context.Background(), requestIDKey{}, "abc")
+	logger.InfoContext(ctx, "hello")
+
+	var record map[string]any
+	if err := json.Unmarshal(b.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["request_id"] != "abc" || record["component"] != "test" {
+		t.Errorf("expected request id to be logged, got %v", record)
+	}
+
+	b.Reset()
+	logger.Info("hello")
+	if bytes.Contains(b.Bytes(), []byte("request_id")) {
+		t.Error("records logged outside of requests should have no request id")
+	}
+}
+
+func TestNewLoggerRejectsInvalidConfig(t *testing.T) {
+	t.Setenv("POST_PIGEON_LOG_OUTPUT", "stdout")
+
+	t.Setenv("POST_PIGEON_LOG_LEVEL", "loud")
+	if _, _, err := NewLogger(); err == nil {
+		t.Error("expected invalid levels to be rejected")
+	}
+
+	t.Setenv("POST_PIGEON_LOG_LEVEL", "debug")
+	t.Setenv("POST_PIGEON_LOG_FORMAT", "xml")
+	if _, _, err := NewLogger(); err == nil {
+		t.Error("expected invalid formats to be rejected")
+	}
+}
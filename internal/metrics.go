@@ -0,0 +1,163 @@
+package internal
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gorm.io/gorm"
+)
+
+// registry holds the metrics we expose. It's our own rather than the default registry, so that only our metrics are
+// served
+var registry = prometheus.NewRegistry()
+
+var metrics = promauto.With(registry)
+
+// durationBuckets are the upper bounds, in seconds, of the buckets durations are observed into
+var durationBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+var (
+	httpRequests = metrics.NewCounterVec(prometheus.CounterOpts{
+		Name: "postpigeon_http_requests_total",
+		Help: "HTTP requests served, by route, method and status code.",
+	}, []string{"route", "method", "status"})
+	httpRequestDuration = metrics.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "postpigeon_http_request_duration_seconds",
+		Help:    "Time taken to serve HTTP requests, by route and method.",
+		Buckets: durationBuckets,
+	}, []string{"route", "method"})
+	rateLimitedRequests = metrics.NewCounter(prometheus.CounterOpts{
+		Name: "postpigeon_rate_limited_requests_total",
+		Help: "Requests turned away by the rate limiter.",
+	})
+	quotasExceeded = metrics.NewCounterVec(prometheus.CounterOpts{
+		Name: "postpigeon_quotas_exceeded_total",
+		Help: "Posts turned away as their author was over a quota, by quota.",
+	}, []string{"quota"})
+
+	postsCreated = metrics.NewCounter(prometheus.CounterOpts{
+		Name: "postpigeon_posts_created_total",
+		Help: "Posts created, drafts included.",
+	})
+	postsDeleted = metrics.NewCounter(prometheus.CounterOpts{
+		Name: "postpigeon_posts_deleted_total",
+		Help: "Posts deleted by their authors, or taken down along with a revoked key.",
+	})
+	postsExpired = metrics.NewCounter(prometheus.CounterOpts{
+		Name: "postpigeon_posts_expired_total",
+		Help: "Posts reaped past their expiration.",
+	})
+	postsTakenDown = metrics.NewCounter(prometheus.CounterOpts{
+		Name: "postpigeon_posts_taken_down_total",
+		Help: "Posts taken down by the operators.",
+	})
+	postsBlocked = metrics.NewCounterVec(prometheus.CounterOpts{
+		Name: "postpigeon_posts_blocked_total",
+		Help: "Posts turned away by the blocklist, by the kind of entry they matched.",
+	}, []string{"kind"})
+	reportsFiled = metrics.NewCounterVec(prometheus.CounterOpts{
+		Name: "postpigeon_reports_filed_total",
+		Help: "Posts reported by readers, by reason.",
+	}, []string{"reason"})
+	signatureFailures = metrics.NewCounterVec(prometheus.CounterOpts{
+		Name: "postpigeon_signature_verification_failures_total",
+		Help: "Signatures that failed verification, by reason.",
+	}, []string{"reason"})
+	proofFailures = metrics.NewCounterVec(prometheus.CounterOpts{
+		Name: "postpigeon_proof_of_work_failures_total",
+		Help: "Posts turned away for lacking a valid proof of work, by reason.",
+	}, []string{"reason"})
+
+	cacheHits = metrics.NewCounter(prometheus.CounterOpts{
+		Name: "postpigeon_post_cache_hits_total",
+		Help: "Posts served from the post cache.",
+	})
+	cacheMisses = metrics.NewCounter(prometheus.CounterOpts{
+		Name: "postpigeon_post_cache_misses_total",
+		Help: "Posts looked up in the db as they weren't in the post cache.",
+	})
+	cacheEvictions = metrics.NewCounter(prometheus.CounterOpts{
+		Name: "postpigeon_post_cache_evictions_total",
+		Help: "Posts removed from the post cache, whether evicted for room, expired or invalidated.",
+	})
+
+	dbQueryDuration = metrics.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "postpigeon_db_query_duration_seconds",
+		Help:    "Time taken by db queries, by operation and table.",
+		Buckets: durationBuckets,
+	}, []string{"operation", "table"})
+)
+
+// MetricsOnAdmin reports whether /metrics is served on the admin listener only, rather than alongside the app.
+// Set POST_PIGEON_METRICS=admin to keep metrics private
+func MetricsOnAdmin() bool {
+	return strings.EqualFold(os.Getenv("POST_PIGEON_METRICS"), "admin")
+}
+
+// serveMetrics writes every metric in the Prometheus text format
+var serveMetrics = echo.WrapHandler(promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+
+// metricsMiddleware counts and times every request by the route it matched, so that the number of series stays
+// bounded however many posts are requested
+func metricsMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+		err := next(c)
+
+		status := c.Response().Status
+		var httpErr *echo.HTTPError
+		if errors.As(err, &httpErr) {
+			status = httpErr.Code
+		} else if err != nil {
+			status = http.StatusInternalServerError
+		}
+
+		route := c.Path()
+		if len(route) == 0 {
+			route = "unmatched"
+		}
+
+		method := c.Request().Method
+		httpRequests.WithLabelValues(route, method, strconv.Itoa(status)).Inc()
+		httpRequestDuration.WithLabelValues(route, method).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+// instrumentDB times every query run through db
+func instrumentDB(db *gorm.DB) error {
+	start := func(tx *gorm.DB) {
+		tx.InstanceSet("metrics:start", time.Now())
+	}
+	observe := func(operation string) func(*gorm.DB) {
+		return func(tx *gorm.DB) {
+			if started, ok := tx.InstanceGet("metrics:start"); ok {
+				dbQueryDuration.WithLabelValues(operation, tx.Statement.Table).Observe(time.Since(started.(time.Time)).Seconds())
+			}
+		}
+	}
+
+	callbacks := db.Callback()
+	return errors.Join(
+		callbacks.Create().Before("*").Register("metrics:before_create", start),
+		callbacks.Create().After("*").Register("metrics:after_create", observe("create")),
+		callbacks.Query().Before("*").Register("metrics:before_query", start),
+		callbacks.Query().After("*").Register("metrics:after_query", observe("query")),
+		callbacks.Update().Before("*").Register("metrics:before_update", start),
+		callbacks.Update().After("*").Register("metrics:after_update", observe("update")),
+		callbacks.Delete().Before("*").Register("metrics:before_delete", start),
+		callbacks.Delete().After("*").Register("metrics:after_delete", observe("delete")),
+		callbacks.Row().Before("*").Register("metrics:before_row", start),
+		callbacks.Row().After("*").Register("metrics:after_row", observe("row")),
+		callbacks.Raw().Before("*").Register("metrics:before_raw", start),
+		callbacks.Raw().After("*").Register("metrics:after_raw", observe("raw")),
+	)
+}
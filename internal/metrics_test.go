@@ -0,0 +1,48 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestMetricsExposition(t *testing.T) {
+	e := echo.New()
+	e.Use(metricsMiddleware)
+	e.GET("/metrics-test/:uuid", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+	e.GET("/metrics", serveMetrics)
+
+	for i := 0; i < 3; i++ {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/metrics-test/"+strings.Repeat("a", i), nil))
+	}
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/metrics-test/missing/route", nil))
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected metrics to be served got %d", rec.Code)
+	}
+	if contentType := rec.Header().Get(echo.HeaderContentType); !strings.HasPrefix(contentType, "text/plain") {
+		t.Errorf("expected the text exposition format got %s", contentType)
+	}
+
+	expected := []string{
+		"# TYPE postpigeon_http_requests_total counter",
+		`postpigeon_http_requests_total{method="GET",route="/metrics-test/:uuid",status="200"} 3`,
+		`postpigeon_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		"# TYPE postpigeon_http_request_duration_seconds histogram",
+		`postpigeon_http_request_duration_seconds_bucket{method="GET",route="/metrics-test/:uuid",le="+Inf"} 3`,
+		`postpigeon_http_request_duration_seconds_count{method="GET",route="/metrics-test/:uuid"} 3`,
+		"# TYPE postpigeon_posts_created_total counter",
+	}
+	for _, line := range expected {
+		if !strings.Contains(rec.Body.String(), line+"\n") {
+			t.Errorf("expected the exposition to contain %q got\n%s", line, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package model
+
+import "time"
+
+// Archive is the manifest of an export of the posts of an author, listing each post along with the file its
+// markdown is found in within the archive
+type Archive struct {
+	Version     int            `json:"version"`
+	Fingerprint string         `json:"fingerprint"`
+	ExportedAt  time.Time      `json:"exported_at"`
+	Posts       []ArchivedPost `json:"posts"`
+}
+
+// ArchivedPost is a post as found in an Archive, with everything needed to verify its signature once its markdown
+// is read back
+type ArchivedPost struct {
+	UUID        string     `json:"uuid"`
+	Title       string     `json:"title"`
+	File        string     `json:"file"`
+	Fingerprint string     `json:"fingerprint"`
+	PublicKey   string     `json:"public_key"`
+	Signature   string     `json:"signature"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// ImportResult lists the uuids of the posts of an archive that were imported, and of those that were skipped as
+// they were already there or had expired since being exported
+type ImportResult struct {
+	Imported []string `json:"imported"`
+	Skipped  []string `json:"skipped"`
+}
@@ -0,0 +1,10 @@
+package model
+
+import "time"
+
+// Backup is a copy of the db kept in the backup dir
+type Backup struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
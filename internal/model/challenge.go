@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+// Challenge is a proof-of-work challenge to be solved before creating a post. A Difficulty of zero means no
+// proof is required
+type Challenge struct {
+	Challenge  string     `json:"challenge,omitempty"`
+	Difficulty int        `json:"difficulty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
@@ -0,0 +1,17 @@
+package model
+
+// Readiness is the outcome of each readiness check, keyed by name
+type Readiness struct {
+	Ready  bool              `json:"ready"`
+	Checks map[string]string `json:"checks"`
+}
+
+// BuildInfo describes the build of the running binary
+type BuildInfo struct {
+	Module       string `json:"module,omitempty"`
+	Version      string `json:"version,omitempty"`
+	GoVersion    string `json:"go_version,omitempty"`
+	Revision     string `json:"revision,omitempty"`
+	RevisionTime string `json:"revision_time,omitempty"`
+	Modified     bool   `json:"modified,omitempty"`
+}
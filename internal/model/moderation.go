@@ -0,0 +1,78 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Report is a reader flagging a post, open until an operator either takes the post down or dismisses the report
+type Report struct {
+	gorm.Model `json:"-"`
+	ID         int        `json:"id"`
+	PostUUID   string     `json:"post_uuid"`
+	Reason     string     `json:"reason"`
+	Details    string     `json:"details,omitempty"`
+	Status     string     `json:"status"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// ReportedPost is a post with open reports, along with what the operators need to judge it
+type ReportedPost struct {
+	UUID        string    `json:"uuid"`
+	Title       string    `json:"title"`
+	Fingerprint string    `json:"fingerprint"`
+	Message     string    `json:"message"`
+	CreatedAt   time.Time `json:"created_at"`
+	Reports     []Report  `json:"reports" gorm:"-"`
+}
+
+// AuditEntry records an action taken on the instance, by whom and when. Actions taken on behalf of a signed request
+// record the fingerprint of the key it was signed by along with the signature, and those taken on behalf of any
+// request a keyed hash of the ip it came from
+type AuditEntry struct {
+	ID          int       `json:"id"`
+	Action      string    `json:"action"`
+	Actor       string    `json:"actor"`
+	PostUUID    *string   `json:"post_uuid,omitempty"`
+	Details     string    `json:"details,omitempty"`
+	Fingerprint *string   `json:"fingerprint,omitempty"`
+	Signature   *string   `json:"signature,omitempty"`
+	IPHash      *string   `json:"ip_hash,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// AuditQuery filters the audit log. Entries are listed the latest first, Before pages through them by id
+type AuditQuery struct {
+	Action      string `query:"action" validate:"omitempty,max=64"`
+	Actor       string `query:"actor" validate:"omitempty,max=256"`
+	Fingerprint string `query:"fingerprint" validate:"omitempty,max=256"`
+	PostUUID    string `query:"post" validate:"omitempty,uuid"`
+	From        string `query:"from" validate:"omitempty,datetime=2006-01-02"`
+	To          string `query:"to" validate:"omitempty,datetime=2006-01-02"`
+	Before      int    `query:"before" validate:"omitempty,min=1"`
+	Limit       int    `query:"limit" validate:"omitempty,min=1,max=1000"`
+}
+
+// BlocklistEntry bars something, e.g. the fingerprint of a key, from the instance
+type BlocklistEntry struct {
+	gorm.Model `json:"-"`
+	ID         int       `json:"id"`
+	Kind       string    `json:"kind"`
+	Value      string    `json:"value"`
+	Reason     string    `json:"reason,omitempty"`
+	CreatedBy  string    `json:"created_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Stats summarises the content of the instance
+type Stats struct {
+	Posts       map[string]int64 `json:"posts"`
+	TakenDown   int64            `json:"taken_down"`
+	Authors     int64            `json:"authors"`
+	StoredBytes int64            `json:"stored_bytes"`
+	OpenReports int64            `json:"open_reports"`
+	Bans        int64            `json:"bans"`
+	CachedPosts int              `json:"cached_posts"`
+}
@@ -11,24 +11,112 @@ type PostRequest struct {
 	PublicKey  string `form:"publickey" validate:"required"`
 	Signature  string `form:"signature" validate:"required"`
 	Expiration string `form:"expiration"`
+	Draft      bool   `form:"draft"`
+	Challenge  string `form:"challenge"`
+	Proof      string `form:"proof"`
 }
 
 type PostDeleteRequest struct {
 	UUID      string `form:"uuid" validate:"required"`
 	Signature string `form:"signature" validate:"required"`
+	PublicKey string `form:"publickey"`
+}
+
+type PublishRequest struct {
+	UUID      string `form:"uuid" validate:"required"`
+	Signature string `form:"signature" validate:"required"`
+	PublicKey string `form:"publickey"`
+}
+
+type VerifyRequest struct {
+	PublicKey string `form:"publickey" json:"publickey" validate:"required"`
+	Signature string `form:"signature" json:"signature" validate:"required"`
+	Message   string `form:"message" json:"message" validate:"required"`
+}
+
+type HandleRequest struct {
+	Handle    string `form:"handle" validate:"required"`
+	PublicKey string `form:"publickey" validate:"required"`
+	Signature string `form:"signature" validate:"required"`
+}
+
+type ProfileRequest struct {
+	Document  string
+	PublicKey string `form:"publickey" validate:"required"`
+	Signature string `form:"signature" validate:"required"`
+}
+
+type RotationRequest struct {
+	Statement    string
+	PublicKey    string `form:"publickey" validate:"required"`
+	Signature    string `form:"signature" validate:"required"`
+	NewPublicKey string `form:"newpublickey" validate:"required"`
+	NewSignature string `form:"newsignature" validate:"required"`
+}
+
+type RevocationRequest struct {
+	Certificate  string
+	PublicKey    string `form:"publickey" validate:"required"`
+	Signature    string `form:"signature" validate:"required"`
+	NewPublicKey string `form:"newpublickey"`
+	NewSignature string `form:"newsignature"`
+}
+
+type DomainRequest struct {
+	Domain    string `form:"domain" validate:"required"`
+	PublicKey string `form:"publickey" validate:"required"`
+	Signature string `form:"signature" validate:"required"`
+}
+
+// ReportRequest flags a post as breaking the rules of the instance, for its operators to look into
+type ReportRequest struct {
+	Reason  string `form:"reason" validate:"required,oneof=illegal spam abuse other"`
+	Details string `form:"details" validate:"max=2000"`
+}
+
+type TakedownRequest struct {
+	Reason string `form:"reason" validate:"required,max=500"`
+}
+
+type BanRequest struct {
+	Reason string `form:"reason" validate:"max=500"`
+}
+
+// BlocklistRequest adds something to the blocklist, see the Block constants for the kinds of things that can be
+type BlocklistRequest struct {
+	Kind   string `form:"kind" validate:"required,oneof=fingerprint hash keyword pattern"`
+	Value  string `form:"value" validate:"required,max=1000"`
+	Reason string `form:"reason" validate:"max=500"`
 }
 
 type UserRequest struct {
 	PublicKey string `form:"publickey" validate:"required"`
 }
 
+// PostQuery describes how a listing of posts should be paginated, sorted and filtered
+type PostQuery struct {
+	Cursor string `query:"cursor"`
+	Limit  int    `query:"limit" validate:"omitempty,min=1,max=100"`
+	Sort   string `query:"sort" validate:"omitempty,oneof=newest oldest title"`
+	From   string `query:"from" validate:"omitempty,datetime=2006-01-02"`
+	To     string `query:"to" validate:"omitempty,datetime=2006-01-02"`
+	Tag    string `query:"tag" validate:"omitempty,max=32"`
+}
+
 type Post struct {
 	gorm.Model
-	ID          int
-	UUID        string
-	Key         string
-	Fingerprint string
-	ExpiresAt   *time.Time
+	ID             int
+	UUID           string
+	Key            string
+	Fingerprint    string
+	Signature      string
+	Slug           *string
+	ExpiresAt      *time.Time
+	Status         string
+	PreviewToken   *string
+	PublishAt      *time.Time
+	TakenDownAt    *time.Time
+	TakedownReason *string
 }
 
 type PostContent struct {
@@ -40,12 +128,197 @@ type PostContent struct {
 	Message  string
 }
 
+type PostTag struct {
+	gorm.Model
+	ID       int
+	PostUUID string
+	Tag      string
+}
+
+// Handle is a human readable name registered to a fingerprint, under which its posts can also be found
+type Handle struct {
+	gorm.Model
+	ID          int
+	Handle      string
+	Fingerprint string
+	Key         string
+	Signature   string
+}
+
+// Profile is a single version of the signed profile document an author publishes about themselves
+type Profile struct {
+	gorm.Model
+	ID          int
+	Fingerprint string
+	Version     int
+	Key         string
+	Document    string
+	Signature   string
+	Name        string
+	Bio         string
+	Avatar      string
+	Links       string
+}
+
+// KeyRotation records an author moving from one key to another. The statement naming both fingerprints
+// is signed by the old key, endorsing the new one, and by the new key, accepting the endorsement
+type KeyRotation struct {
+	gorm.Model
+	ID              int
+	FromFingerprint string
+	ToFingerprint   string
+	FromKey         string
+	ToKey           string
+	Statement       string
+	Signature       string
+	NewSignature    string
+}
+
+// KeyRevocation records an author disowning one of their keys, through a certificate signed by that key
+type KeyRevocation struct {
+	gorm.Model
+	ID          int
+	Fingerprint string
+	Key         string
+	Certificate string
+	Signature   string
+	Reason      string
+	Successor   string
+}
+
+// DomainVerification is the claim of an author to a domain, verified once the domain publishes their key
+type DomainVerification struct {
+	gorm.Model
+	ID          int
+	Domain      string
+	Fingerprint string
+	Key         string
+	Signature   string
+	Status      string
+	// ClaimedAt is when the claim was last made, pending claims are failed once it's too long ago
+	ClaimedAt  time.Time
+	CheckedAt  *time.Time
+	VerifiedAt *time.Time
+}
+
 type FullPost struct {
+	ID          int
 	UUID        string
 	Key         string
 	Fingerprint string
+	Signature   string
+	Slug        *string
+	Status      string
+	PublishAt   *time.Time
 	Title       string
 	HTML        string
 	Message     string
 	CreatedAt   time.Time
+	ExpiresAt   *time.Time
+	Tags        []string `gorm:"-"`
+}
+
+// PostBundle holds everything needed to verify the authorship of a post independently of post-pigeon
+type PostBundle struct {
+	UUID        string    `json:"uuid"`
+	Title       string    `json:"title"`
+	Fingerprint string    `json:"fingerprint"`
+	PublicKey   string    `json:"public_key"`
+	Signature   string    `json:"signature,omitempty"`
+	Message     string    `json:"message"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// SignatureVerification describes the outcome of checking a signature against the key and message it claims
+type SignatureVerification struct {
+	UUID        string `json:"uuid,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+	PublicKey   string `json:"public_key"`
+	Signature   string `json:"signature"`
+	Algorithm   string `json:"algorithm"`
+	Curve       string `json:"curve,omitempty"`
+	MessageHash string `json:"message_hash"`
+	Valid       bool   `json:"valid"`
+	Revoked     bool   `json:"revoked,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// PostSummary is the listing entry for a post, as found in a PostPage
+type PostSummary struct {
+	UUID        string     `json:"uuid"`
+	Title       string     `json:"title"`
+	Fingerprint string     `json:"fingerprint"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// PostPage is a single page of a post listing. The cursors, when set, can be passed back
+// as PostQuery.Cursor to fetch the neighbouring pages
+type PostPage struct {
+	Posts      []PostSummary `json:"posts"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+	PrevCursor string        `json:"prev_cursor,omitempty"`
+}
+
+// ProfileStatement is a version of an author profile as served to clients, along with what's needed to verify it
+type ProfileStatement struct {
+	Fingerprint string    `json:"fingerprint"`
+	Version     int       `json:"version"`
+	Name        string    `json:"name,omitempty"`
+	Bio         string    `json:"bio,omitempty"`
+	Avatar      string    `json:"avatar,omitempty"`
+	Links       []string  `json:"links,omitempty"`
+	PublicKey   string    `json:"public_key"`
+	Document    string    `json:"document"`
+	Signature   string    `json:"signature"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// RotationStatement is a KeyRotation as served to clients, along with what's needed to verify it
+type RotationStatement struct {
+	FromFingerprint string    `json:"from_fingerprint"`
+	ToFingerprint   string    `json:"to_fingerprint"`
+	FromPublicKey   string    `json:"from_public_key"`
+	ToPublicKey     string    `json:"to_public_key"`
+	Statement       string    `json:"statement"`
+	Signature       string    `json:"signature"`
+	NewSignature    string    `json:"new_signature"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// RevocationStatement is a KeyRevocation as served to clients, along with what's needed to verify it
+type RevocationStatement struct {
+	Fingerprint string    `json:"fingerprint"`
+	PublicKey   string    `json:"public_key"`
+	Certificate string    `json:"certificate"`
+	Signature   string    `json:"signature"`
+	Reason      string    `json:"reason,omitempty"`
+	Successor   string    `json:"successor,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// KeyHistory is the chain of keys an author has published under, oldest first. Fingerprint is the current key
+type KeyHistory struct {
+	Fingerprint  string                `json:"fingerprint"`
+	Fingerprints []string              `json:"fingerprints"`
+	Rotations    []RotationStatement   `json:"rotations"`
+	Revocations  []RevocationStatement `json:"revocations"`
+}
+
+// DomainStatement is the state of a DomainVerification as served to clients
+type DomainStatement struct {
+	Domain      string     `json:"domain"`
+	Fingerprint string     `json:"fingerprint"`
+	Status      string     `json:"status"`
+	CheckedAt   *time.Time `json:"checked_at,omitempty"`
+	VerifiedAt  *time.Time `json:"verified_at,omitempty"`
+}
+
+// FingerprintFormats holds the renderings of a fingerprint, any of which can be used to look it up
+type FingerprintFormats struct {
+	Fingerprint string `json:"fingerprint"`
+	SHA256      string `json:"sha256"`
+	Hex         string `json:"hex"`
+	Words       string `json:"words"`
+	Emoji       string `json:"emoji"`
 }
@@ -0,0 +1,82 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jtanza/post-pigeon/internal/model"
+)
+
+const (
+	ReportOpen      = "open"
+	ReportActioned  = "actioned"
+	ReportDismissed = "dismissed"
+)
+
+// ErrPostNotFound is returned when moderating a post that doesn't exist, or isn't in the state the action expects
+var ErrPostNotFound = errors.New("post not found")
+
+// ReportPost flags the post identified by postUUID for the operators to look into. Only public posts can be
+// reported, returning nil when there's no such post
+func (pm PostManager) ReportPost(postUUID string, request model.ReportRequest) (*model.Report, error) {
+	post, err := pm.FetchPost(postUUID)
+	if err != nil || post == nil {
+		return nil, err
+	}
+
+	report := model.Report{PostUUID: post.UUID, Reason: request.Reason, Details: request.Details, Status: ReportOpen}
+	if err = pm.db.PersistReport(report, pm.newAuditEntry(AuditReportPost, actorReader, post.UUID, request.Reason)); err != nil {
+		return nil, err
+	}
+	reportsFiled.WithLabelValues(request.Reason).Inc()
+
+	return &report, nil
+}
+
+// ModerationQueue returns the posts awaiting moderation, the most reported first
+func (pm PostManager) ModerationQueue() ([]model.ReportedPost, error) {
+	return pm.db.GetReportedPosts()
+}
+
+// TakeDownPost hides the post identified by postUUID from everyone for reason, on behalf of actor. Unlike posts
+// deleted by their authors, posts taken down are kept, to be restored should the takedown turn out to be a mistake
+func (pm PostManager) TakeDownPost(postUUID, reason, actor string) error {
+	entry := pm.newAuditEntry(AuditTakedown, actor, postUUID, reason)
+	if found, err := pm.db.TakeDownPost(postUUID, reason, entry); err != nil {
+		return err
+	} else if !found {
+		return fmt.Errorf("%w: %s", ErrPostNotFound, postUUID)
+	}
+
+	pm.cache.Remove(postUUID)
+	postsTakenDown.Inc()
+	return nil
+}
+
+// RestorePost makes the post identified by postUUID public again after it was taken down, on behalf of actor
+func (pm PostManager) RestorePost(postUUID, actor string) error {
+	entry := pm.newAuditEntry(AuditRestore, actor, postUUID, "")
+	if found, err := pm.db.RestorePost(postUUID, entry); err != nil {
+		return err
+	} else if !found {
+		return fmt.Errorf("%w: no post %s was taken down", ErrPostNotFound, postUUID)
+	}
+	return nil
+}
+
+// DismissReports resolves the open reports of the post identified by postUUID without acting on them, on behalf of actor
+func (pm PostManager) DismissReports(postUUID, actor string) error {
+	entry := pm.newAuditEntry(AuditDismissReport, actor, postUUID, "")
+	if found, err := pm.db.DismissReports(postUUID, entry); err != nil {
+		return err
+	} else if !found {
+		return fmt.Errorf("%w: no post %s has open reports", ErrPostNotFound, postUUID)
+	}
+	return nil
+}
+
+// FetchTakedown returns the post identified by postUUID if it was taken down, so that it can be told apart from
+// posts that don't exist
+func (pm PostManager) FetchTakedown(postUUID string) (*model.Post, error) {
+	return pm.db.GetTakenDownPost(postUUID)
+}
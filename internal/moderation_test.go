@@ -0,0 +1,154 @@
+package internal
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/jtanza/post-pigeon/internal/model"
+)
+
+// auditEntries returns the entries recording action on the post with postUUID
+func auditEntries(t *testing.T, pm PostManager, action, postUUID string) []model.AuditEntry {
+	entries, err := pm.FetchAuditLog(model.AuditQuery{Action: action, PostUUID: postUUID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+// visibility reports whether the post with postUUID by key can be fetched, listed and exported
+func visibility(t *testing.T, pm PostManager, key testKey, postUUID string) (fetched, listed, exported bool) {
+	post, err := pm.FetchPost(postUUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listing, err := newPostListing(model.PostQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	listing.Fingerprints = []string{key.fingerprint}
+	posts, err := pm.db.GetPosts(listing)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exported, err = pm.ExportPosts(key.fingerprint, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return post != nil, len(posts) == 1 && posts[0].UUID == postUUID, exported
+}
+
+func TestModeration(t *testing.T) {
+	pm := newTestPostManager(t, newTestDB(t))
+	key := newTestKey(t)
+	post := createTestPost(t, pm, key, "reported", "# reported")
+
+	if _, err := pm.ReportPost(post.UUID, model.ReportRequest{Reason: "spam", Details: "buy now"}); err != nil {
+		t.Fatal(err)
+	}
+	queue, err := pm.ModerationQueue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queue) != 1 || queue[0].UUID != post.UUID || len(queue[0].Reports) != 1 || queue[0].Reports[0].Reason != "spam" {
+		t.Fatalf("expected the reported post to be queued along with its report got %+v", queue)
+	}
+	if entries := auditEntries(t, pm, AuditReportPost, post.UUID); len(entries) != 1 || entries[0].Actor != actorReader {
+		t.Errorf("expected the report to be audited once got %+v", entries)
+	}
+
+	if fetched, listed, exported := visibility(t, pm, key, post.UUID); !fetched || !listed || !exported || !pm.cache.Has(post.UUID) {
+		t.Fatalf("expected the post to be public and cached once fetched, fetched %t, listed %t, exported %t", fetched, listed, exported)
+	}
+	if err = pm.TakeDownPost(post.UUID, "spam", "operator"); err != nil {
+		t.Fatal(err)
+	}
+	if pm.cache.Has(post.UUID) {
+		t.Error("expected the post taken down to be dropped from the cache")
+	}
+	if fetched, listed, exported := visibility(t, pm, key, post.UUID); fetched || listed || exported {
+		t.Errorf("expected the post taken down to be hidden, fetched %t, listed %t, exported %t", fetched, listed, exported)
+	}
+	if queue, err = pm.ModerationQueue(); err != nil || len(queue) != 0 {
+		t.Errorf("expected the reports of the post taken down to be resolved got %+v: %v", queue, err)
+	}
+	if entries := auditEntries(t, pm, AuditTakedown, post.UUID); len(entries) != 1 || entries[0].Actor != "operator" || entries[0].Details != "spam" {
+		t.Errorf("expected the takedown to be audited once got %+v", entries)
+	}
+
+	if err = pm.RestorePost(post.UUID, "operator"); err != nil {
+		t.Fatal(err)
+	}
+	if fetched, listed, exported := visibility(t, pm, key, post.UUID); !fetched || !listed || !exported {
+		t.Errorf("expected the post restored to be public again, fetched %t, listed %t, exported %t", fetched, listed, exported)
+	}
+	if entries := auditEntries(t, pm, AuditRestore, post.UUID); len(entries) != 1 {
+		t.Errorf("expected the restore to be audited once got %+v", entries)
+	}
+
+	if _, err = pm.ReportPost(post.UUID, model.ReportRequest{Reason: "other"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = pm.DismissReports(post.UUID, "operator"); err != nil {
+		t.Fatal(err)
+	}
+	if queue, err = pm.ModerationQueue(); err != nil || len(queue) != 0 {
+		t.Errorf("expected the dismissed reports to be resolved got %+v: %v", queue, err)
+	}
+	if fetched, _, _ := visibility(t, pm, key, post.UUID); !fetched {
+		t.Error("expected dismissing reports to leave the post up")
+	}
+	if entries := auditEntries(t, pm, AuditDismissReport, post.UUID); len(entries) != 1 {
+		t.Errorf("expected the dismissal to be audited once got %+v", entries)
+	}
+}
+
+func TestModerationOfPostsInTheWrongState(t *testing.T) {
+	pm := newTestPostManager(t, newTestDB(t))
+	post := createTestPost(t, pm, newTestKey(t), "post", "# post")
+
+	if err := pm.RestorePost(post.UUID, "operator"); !errors.Is(err, ErrPostNotFound) {
+		t.Errorf("expected restoring a post that wasn't taken down to be refused got %v", err)
+	}
+	if err := pm.DismissReports(post.UUID, "operator"); !errors.Is(err, ErrPostNotFound) {
+		t.Errorf("expected dismissing the reports of a post without any to be refused got %v", err)
+	}
+	if err := pm.TakeDownPost("00000000-0000-0000-0000-000000000000", "spam", "operator"); !errors.Is(err, ErrPostNotFound) {
+		t.Errorf("expected taking down a post that doesn't exist to be refused got %v", err)
+	}
+
+	for _, action := range []string{AuditRestore, AuditDismissReport} {
+		if entries := auditEntries(t, pm, action, post.UUID); len(entries) != 0 {
+			t.Errorf("expected actions that were refused not to be audited got %+v", entries)
+		}
+	}
+}
+
+func TestModerationIsAuditedInItsTransaction(t *testing.T) {
+	db := newTestDB(t)
+	pm := newTestPostManager(t, db)
+	key := newTestKey(t)
+	post := createTestPost(t, pm, key, "post", "# post")
+
+	// with nowhere to record them, actions must not take place unrecorded
+	if err := db.db.Exec("drop table audit_entry").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := pm.ReportPost(post.UUID, model.ReportRequest{Reason: "spam"}); err == nil {
+		t.Error("expected a report that couldn't be audited to fail")
+	}
+	if queue, err := pm.ModerationQueue(); err != nil || len(queue) != 0 {
+		t.Errorf("expected a report that couldn't be audited not to be filed got %+v: %v", queue, err)
+	}
+
+	if err := pm.TakeDownPost(post.UUID, "spam", "operator"); err == nil {
+		t.Error("expected a takedown that couldn't be audited to fail")
+	}
+	if fetched, _, _ := visibility(t, pm, key, post.UUID); !fetched {
+		t.Error("expected a takedown that couldn't be audited to leave the post up")
+	}
+}
@@ -0,0 +1,238 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// The headers admin requests are signed with
+const (
+	HeaderAdminKey       = "X-Admin-Key"
+	HeaderAdminTimestamp = "X-Admin-Timestamp"
+	HeaderAdminSignature = "X-Admin-Signature"
+)
+
+const (
+	// adminClockSkew is how far the timestamp of an admin request can be from the time it's received at
+	adminClockSkew = 5 * time.Minute
+	// maxAdminBodySize caps the bodies of admin requests, which are read whole to be verified
+	maxAdminBodySize = 10 << 20
+
+	operatorKey = "operator"
+)
+
+// ErrUnauthorizedOperator is returned for admin requests that aren't signed by the key of an operator
+var ErrUnauthorizedOperator = errors.New("unauthorized")
+
+// OperatorKeys are the public keys of the operators of the instance, keyed by fingerprint
+type OperatorKeys map[string]string
+
+// LoadOperatorKeys reads the public keys of the operators from the PEM file at POST_PIGEON_ADMIN_KEYS, which can
+// hold any number of them. Without operator keys every admin request is refused
+func LoadOperatorKeys() (OperatorKeys, error) {
+	path := os.Getenv("POST_PIGEON_ADMIN_KEYS")
+	if len(path) == 0 {
+		return OperatorKeys{}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read operator keys: %w", err)
+	}
+	return ParseOperatorKeys(data)
+}
+
+// ParseOperatorKeys parses every PEM encoded public key in data
+func ParseOperatorKeys(data []byte) (OperatorKeys, error) {
+	keys := OperatorKeys{}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		key := string(pem.EncodeToMemory(block))
+		if _, err := parsePublicKey(key); err != nil {
+			return nil, fmt.Errorf("invalid operator key: %w", err)
+		}
+		fingerprint, err := Fingerprint(key)
+		if err != nil {
+			return nil, err
+		}
+		keys[fingerprint] = key
+	}
+
+	if len(bytes.TrimSpace(data)) > 0 {
+		return nil, errors.New("invalid operator keys: trailing data after the last PEM block")
+	}
+	return keys, nil
+}
+
+// AdminMessage returns what admin requests are signed over: their method, request uri, timestamp and the hex
+// encoded sha256 of their body, each on a line of its own
+func AdminMessage(method, uri, timestamp string, body []byte) string {
+	hash := sha256.Sum256(body)
+	return strings.Join([]string{method, uri, timestamp, hex.EncodeToString(hash[:])}, "\n")
+}
+
+// SignAdminRequest signs request, whose body is body, with the private key of an operator
+func SignAdminRequest(request *http.Request, body []byte, key *ecdsa.PrivateKey) error {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return err
+	}
+	fingerprint, err := Fingerprint(string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})))
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	hash := sha1.Sum([]byte(AdminMessage(request.Method, request.URL.RequestURI(), timestamp, body)))
+	signature, err := ecdsa.SignASN1(rand.Reader, key, hash[:])
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set(HeaderAdminKey, fingerprint)
+	request.Header.Set(HeaderAdminTimestamp, timestamp)
+	request.Header.Set(HeaderAdminSignature, base64.StdEncoding.EncodeToString(signature))
+	return nil
+}
+
+// ParsePrivateKey parses a PEM encoded ECDSA private key, as generated by `openssl ecparam -genkey`
+func ParsePrivateKey(data []byte) (*ecdsa.PrivateKey, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("no private key found")
+		}
+
+		switch block.Type {
+		case "EC PRIVATE KEY":
+			return x509.ParseECPrivateKey(block.Bytes)
+		case "PRIVATE KEY":
+			key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			ecKey, ok := key.(*ecdsa.PrivateKey)
+			if !ok {
+				return nil, errors.New("private key is not an ECDSA key")
+			}
+			return ecKey, nil
+		}
+	}
+}
+
+// OperatorAuth authenticates admin requests as coming from an operator. Requests are signed, just as posts are,
+// by the key of an operator over AdminMessage, and are only accepted once and close to when they were signed
+type OperatorAuth struct {
+	keys  OperatorKeys
+	store RateLimitStore
+}
+
+// NewOperatorAuth returns an OperatorAuth accepting requests signed by keys, remembering the signatures it
+// accepted in store so they can't be replayed
+func NewOperatorAuth(keys OperatorKeys, store RateLimitStore) OperatorAuth {
+	if len(keys) == 0 {
+		slog.Warn("no operator keys configured, admin requests will be refused")
+	}
+	return OperatorAuth{keys, store}
+}
+
+// authenticate returns the fingerprint of the operator that signed request, whose body is body
+func (o OperatorAuth) authenticate(c echo.Context, body []byte) (string, error) {
+	request := c.Request()
+	fingerprint := request.Header.Get(HeaderAdminKey)
+	timestamp := request.Header.Get(HeaderAdminTimestamp)
+	signature := request.Header.Get(HeaderAdminSignature)
+	if len(fingerprint) == 0 || len(timestamp) == 0 || len(signature) == 0 {
+		return "", fmt.Errorf("%w: admin requests must be signed by an operator", ErrUnauthorizedOperator)
+	}
+
+	key, ok := o.keys[fingerprint]
+	if !ok {
+		return "", fmt.Errorf("%w: unknown operator key", ErrUnauthorizedOperator)
+	}
+
+	signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid timestamp", ErrUnauthorizedOperator)
+	}
+	if skew := time.Since(time.Unix(signedAt, 0)); skew > adminClockSkew || skew < -adminClockSkew {
+		return "", fmt.Errorf("%w: the request was signed too long ago, or the clocks are off", ErrUnauthorizedOperator)
+	}
+
+	if err = ValidateSignature(key, signature, AdminMessage(request.Method, request.RequestURI, timestamp, body)); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrUnauthorizedOperator, err)
+	}
+
+	// a signature is valid for as long as its timestamp is, so remembering it that long is enough to refuse replays.
+	// It's remembered by its nonce rather than as sent, as (r, s) and (r, n-s) are both valid encodings of it
+	nonce, err := signatureNonce(signature)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrUnauthorizedOperator, err)
+	}
+	replayed, err := o.store.Remember(request.Context(), fmt.Sprintf("admin-signature:%s:%s", fingerprint, nonce.Text(16)), 2*adminClockSkew)
+	if err != nil {
+		return "", err
+	}
+	if replayed {
+		signatureFailures.WithLabelValues("replayed").Inc()
+		return "", fmt.Errorf("%w: the request has already been made, sign it again", ErrUnauthorizedOperator)
+	}
+
+	return fingerprint, nil
+}
+
+// middleware refuses admin requests that aren't signed by an operator, with a 401. The fingerprint of the operator
+// requests are signed by is kept in the context, see operator
+func (o OperatorAuth) middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			body, err := io.ReadAll(http.MaxBytesReader(c.Response(), c.Request().Body, maxAdminBodySize))
+			if err != nil {
+				return echo.NewHTTPError(http.StatusRequestEntityTooLarge, err.Error())
+			}
+			c.Request().Body = io.NopCloser(bytes.NewReader(body))
+
+			fingerprint, err := o.authenticate(c, body)
+			if errors.Is(err, ErrUnauthorizedOperator) {
+				slog.WarnContext(c.Request().Context(), "refused admin request", "error", err, "remote_ip", c.RealIP())
+				return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+			} else if err != nil {
+				return err
+			}
+
+			c.Set(operatorKey, fingerprint)
+			c.SetRequest(c.Request().WithContext(withOperatorSignature(c.Request().Context(), fingerprint, c.Request().Header.Get(HeaderAdminSignature))))
+			return next(c)
+		}
+	}
+}
+
+// operator returns the fingerprint of the operator c was signed by
+func operator(c echo.Context) string {
+	fingerprint, _ := c.Get(operatorKey).(string)
+	return fingerprint
+}
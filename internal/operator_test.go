@@ -0,0 +1,152 @@
+package internal
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func newOperatorKey(t *testing.T) (*ecdsa.PrivateKey, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func TestParseOperatorKeys(t *testing.T) {
+	_, first := newOperatorKey(t)
+	_, second := newOperatorKey(t)
+
+	keys, err := ParseOperatorKeys([]byte(first + "\n" + second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("expected 2 operator keys got %d", len(keys))
+	}
+	fingerprint, _ := Fingerprint(first)
+	if keys[fingerprint] != first {
+		t.Errorf("expected operator keys to be keyed by fingerprint")
+	}
+
+	if _, err = ParseOperatorKeys([]byte(first + "not a key")); err == nil {
+		t.Error("expected trailing data to be refused")
+	}
+}
+
+func TestOperatorAuth(t *testing.T) {
+	key, publicKey := newOperatorKey(t)
+	keys, err := ParseOperatorKeys([]byte(publicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := NewOperatorAuth(keys, NewMemoryRateLimitStore())
+
+	authenticate := func(request *http.Request, body string) (string, error) {
+		c := echo.New().NewContext(request, httptest.NewRecorder())
+		return auth.authenticate(c, []byte(body))
+	}
+	signed := func(body string) *http.Request {
+		request := httptest.NewRequest(http.MethodPost, "/bans/abc?x=1", strings.NewReader(body))
+		if err := SignAdminRequest(request, []byte(body), key); err != nil {
+			t.Fatal(err)
+		}
+		return request
+	}
+
+	request := signed("reason=spam")
+	fingerprint, err := authenticate(request, "reason=spam")
+	if err != nil {
+		t.Fatalf("expected a signed request to be authenticated: %v", err)
+	}
+	if expected, _ := Fingerprint(publicKey); fingerprint != expected {
+		t.Errorf("expected the request to be made by %s got %s", expected, fingerprint)
+	}
+
+	if _, err = authenticate(request, "reason=spam"); !errors.Is(err, ErrUnauthorizedOperator) {
+		t.Errorf("expected a replayed request to be refused got %v", err)
+	}
+
+	if _, err = authenticate(signed("reason=spam"), "reason=other"); !errors.Is(err, ErrUnauthorizedOperator) {
+		t.Errorf("expected a request with a tampered body to be refused got %v", err)
+	}
+
+	stale := signed("")
+	stale.Header.Set(HeaderAdminTimestamp, strconv.FormatInt(time.Now().Add(-2*adminClockSkew).Unix(), 10))
+	if _, err = authenticate(stale, ""); !errors.Is(err, ErrUnauthorizedOperator) {
+		t.Errorf("expected a stale request to be refused got %v", err)
+	}
+
+	otherKey, _ := newOperatorKey(t)
+	unknown := httptest.NewRequest(http.MethodGet, "/stats", nil)
+	if err = SignAdminRequest(unknown, nil, otherKey); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = authenticate(unknown, ""); !errors.Is(err, ErrUnauthorizedOperator) {
+		t.Errorf("expected a request signed by an unknown key to be refused got %v", err)
+	}
+
+	if _, err = authenticate(httptest.NewRequest(http.MethodGet, "/stats", nil), ""); !errors.Is(err, ErrUnauthorizedOperator) {
+		t.Errorf("expected an unsigned request to be refused got %v", err)
+	}
+}
+
+func TestOperatorAuthRefusesMalleatedReplays(t *testing.T) {
+	key, publicKey := newOperatorKey(t)
+	keys, err := ParseOperatorKeys([]byte(publicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := NewOperatorAuth(keys, NewMemoryRateLimitStore())
+
+	request := httptest.NewRequest(http.MethodDelete, "/bans/abc", nil)
+	if err = SignAdminRequest(request, nil, key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = auth.authenticate(echo.New().NewContext(request, httptest.NewRecorder()), nil); err != nil {
+		t.Fatalf("expected a signed request to be authenticated: %v", err)
+	}
+
+	// (r, n-s) verifies just as (r, s) does, without being the same signature as sent
+	der, err := base64.StdEncoding.DecodeString(request.Header.Get(HeaderAdminSignature))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var signature ecdsaSignature
+	if _, err = asn1.Unmarshal(der, &signature); err != nil {
+		t.Fatal(err)
+	}
+	signature.S = new(big.Int).Sub(key.Curve.Params().N, signature.S)
+	if der, err = asn1.Marshal(signature); err != nil {
+		t.Fatal(err)
+	}
+	malleated := base64.StdEncoding.EncodeToString(der)
+	message := AdminMessage(request.Method, request.RequestURI, request.Header.Get(HeaderAdminTimestamp), nil)
+	if err = ValidateSignature(publicKey, malleated, message); err != nil {
+		t.Fatalf("expected the malleated signature to be valid: %v", err)
+	}
+
+	request.Header.Set(HeaderAdminSignature, malleated)
+	if _, err = auth.authenticate(echo.New().NewContext(request, httptest.NewRecorder()), nil); !errors.Is(err, ErrUnauthorizedOperator) {
+		t.Errorf("expected a replay with a malleated signature to be refused got %v", err)
+	}
+}
@@ -0,0 +1,200 @@
+package internal
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/jtanza/post-pigeon/internal/model"
+)
+
+const (
+	defaultPageSize = 25
+	defaultPostSort = "newest"
+)
+
+// ErrInvalidQuery is returned when a listing is requested with parameters we can't make sense of
+var ErrInvalidQuery = errors.New("invalid listing query")
+
+// postSort describes the column a listing of posts is ordered by. Ties are always broken by post id
+type postSort struct {
+	column string
+	desc   bool
+}
+
+var postSorts = map[string]postSort{
+	"newest": {"post.created_at", true},
+	"oldest": {"post.created_at", false},
+	"title":  {"post_content.title", false},
+}
+
+// pageCursor marks the post a listing should continue from: the listing resumes after it,
+// or before it when paging backwards
+type pageCursor struct {
+	Sort   string    `json:"s"`
+	ID     int       `json:"i"`
+	Title  string    `json:"t,omitempty"`
+	Date   time.Time `json:"d,omitempty"`
+	Before bool      `json:"b,omitempty"`
+}
+
+// value returns the value of the sorted column for the post the cursor points at
+func (c pageCursor) value() any {
+	if postSorts[c.Sort].column == "post_content.title" {
+		return c.Title
+	}
+	return c.Date
+}
+
+func (c pageCursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodePageCursor(encoded string) (*pageCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	var c pageCursor
+	if err = json.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// PostListing describes the posts GetPosts should return and the window of them to return
+type PostListing struct {
+	Fingerprints []string
+	Tag          string
+	From         *time.Time
+	To           *time.Time
+	Sort         postSort
+	Cursor       *pageCursor
+	Limit        int
+}
+
+// newPostListing parses the user provided query into a PostListing, filling in defaults for anything left unset
+func newPostListing(query model.PostQuery) (PostListing, error) {
+	listing := PostListing{Limit: query.Limit, Tag: Slugify(query.Tag)}
+	if listing.Limit == 0 {
+		listing.Limit = defaultPageSize
+	}
+
+	sortName := sortName(query)
+	sort, ok := postSorts[sortName]
+	if !ok {
+		return listing, fmt.Errorf("%w: unknown sort %s", ErrInvalidQuery, sortName)
+	}
+	listing.Sort = sort
+
+	if len(query.Cursor) > 0 {
+		cursor, err := decodePageCursor(query.Cursor)
+		if err != nil || cursor.Sort != sortName {
+			return listing, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+		}
+		listing.Cursor = cursor
+	}
+
+	if len(query.From) > 0 {
+		from, err := time.Parse(time.DateOnly, query.From)
+		if err != nil {
+			return listing, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+		}
+		listing.From = &from
+	}
+
+	if len(query.To) > 0 {
+		to, err := time.Parse(time.DateOnly, query.To)
+		if err != nil {
+			return listing, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+		}
+		// dates are inclusive, so include everything up until the start of the following day
+		to = to.AddDate(0, 0, 1)
+		listing.To = &to
+	}
+
+	return listing, nil
+}
+
+// newPostPage assembles the page of a listing from the posts found for it. posts is expected to hold
+// up to one more post than the listing limit, which is used only to tell whether another page follows
+func newPostPage(query model.PostQuery, listing PostListing, posts []model.FullPost) model.PostPage {
+	backwards := listing.Cursor != nil && listing.Cursor.Before
+	hasMore := len(posts) > listing.Limit
+	if hasMore {
+		posts = posts[:listing.Limit]
+	}
+	if backwards {
+		// backwards pages are fetched in reverse order
+		for i, j := 0, len(posts)-1; i < j; i, j = i+1, j-1 {
+			posts[i], posts[j] = posts[j], posts[i]
+		}
+	}
+
+	page := model.PostPage{Posts: make([]model.PostSummary, 0, len(posts))}
+	for _, p := range posts {
+		page.Posts = append(page.Posts, model.PostSummary{
+			UUID:        p.UUID,
+			Title:       p.Title,
+			Fingerprint: p.Fingerprint,
+			CreatedAt:   p.CreatedAt,
+			ExpiresAt:   p.ExpiresAt,
+		})
+	}
+	if len(posts) == 0 {
+		return page
+	}
+
+	sortName := sortName(query)
+	if hasMore || backwards {
+		page.NextCursor = newPageCursor(sortName, posts[len(posts)-1], false).encode()
+	}
+	if backwards && hasMore || !backwards && listing.Cursor != nil {
+		page.PrevCursor = newPageCursor(sortName, posts[0], true).encode()
+	}
+
+	return page
+}
+
+func newPageCursor(sort string, post model.FullPost, before bool) pageCursor {
+	return pageCursor{Sort: sort, ID: post.ID, Title: post.Title, Date: post.CreatedAt, Before: before}
+}
+
+// pageLink returns the relative URL linking to the page of a listing starting at cursor,
+// preserving the sorting and filtering of the current query
+func pageLink(query model.PostQuery, cursor string) template.URL {
+	v := url.Values{}
+	if len(query.Sort) > 0 {
+		v.Set("sort", query.Sort)
+	}
+	if len(query.From) > 0 {
+		v.Set("from", query.From)
+	}
+	if len(query.To) > 0 {
+		v.Set("to", query.To)
+	}
+	if len(query.Tag) > 0 {
+		v.Set("tag", query.Tag)
+	}
+	if query.Limit > 0 {
+		v.Set("limit", strconv.Itoa(query.Limit))
+	}
+	if len(cursor) > 0 {
+		v.Set("cursor", cursor)
+	}
+	return template.URL("?" + v.Encode())
+}
+
+func sortName(query model.PostQuery) string {
+	if len(query.Sort) == 0 {
+		return defaultPostSort
+	}
+	return query.Sort
+}
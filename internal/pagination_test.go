@@ -0,0 +1,77 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jtanza/post-pigeon/internal/model"
+)
+
+func TestPageCursorRoundTrip(t *testing.T) {
+	cursor := pageCursor{Sort: "title", ID: 42, Title: "hello world", Date: time.Date(2024, 5, 8, 20, 51, 0, 0, time.UTC), Before: true}
+
+	decoded, err := decodePageCursor(cursor.encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *decoded != cursor {
+		t.Errorf("cursor did not survive encoding\n got: %+v wanted: %+v", *decoded, cursor)
+	}
+}
+
+func TestNewPostListingDefaults(t *testing.T) {
+	listing, err := newPostListing(model.PostQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if listing.Limit != defaultPageSize {
+		t.Errorf("expected default page size got %d", listing.Limit)
+	}
+	if listing.Sort != postSorts[defaultPostSort] {
+		t.Errorf("expected default sort got %+v", listing.Sort)
+	}
+}
+
+func TestNewPostListingInclusiveDates(t *testing.T) {
+	listing, err := newPostListing(model.PostQuery{From: "2024-05-01", To: "2024-05-31"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC); !listing.To.Equal(expected) {
+		t.Errorf("expected listing to end at %s got %s", expected, listing.To)
+	}
+}
+
+func TestNewPostListingRejectsMismatchedCursor(t *testing.T) {
+	cursor := pageCursor{Sort: "title", ID: 1}.encode()
+	if _, err := newPostListing(model.PostQuery{Sort: "newest", Cursor: cursor}); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("expected cursors from another sort to be rejected, got %v", err)
+	}
+
+	if _, err := newPostListing(model.PostQuery{Cursor: "not a cursor"}); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("expected malformed cursors to be rejected, got %v", err)
+	}
+}
+
+func TestNewPostPageCursors(t *testing.T) {
+	posts := []model.FullPost{{ID: 1, Title: "a"}, {ID: 2, Title: "b"}, {ID: 3, Title: "c"}}
+
+	first := newPostPage(model.PostQuery{}, PostListing{Limit: 2}, posts)
+	if len(first.Posts) != 2 || len(first.NextCursor) == 0 || len(first.PrevCursor) != 0 {
+		t.Errorf("first page should link only to the next page: %+v", first)
+	}
+
+	next, _ := decodePageCursor(first.NextCursor)
+	last := newPostPage(model.PostQuery{}, PostListing{Limit: 2, Cursor: next}, posts[2:])
+	if len(last.Posts) != 1 || len(last.NextCursor) != 0 || len(last.PrevCursor) == 0 {
+		t.Errorf("last page should link only to the previous page: %+v", last)
+	}
+
+	prev, _ := decodePageCursor(last.PrevCursor)
+	// backwards pages are fetched in reverse order
+	back := newPostPage(model.PostQuery{}, PostListing{Limit: 2, Cursor: prev}, []model.FullPost{posts[1], posts[0]})
+	if back.Posts[0].Title != "a" || len(back.NextCursor) == 0 || len(back.PrevCursor) != 0 {
+		t.Errorf("paging back to the first page should restore its order: %+v", back)
+	}
+}
@@ -2,6 +2,7 @@ package internal
 
 import (
 	"bytes"
+	"context"
 	"encoding/gob"
 	"errors"
 	"fmt"
@@ -9,59 +10,170 @@ import (
 	"github.com/gomarkdown/markdown"
 	"github.com/gomarkdown/markdown/html"
 	"github.com/gomarkdown/markdown/parser"
-	"github.com/labstack/gommon/log"
 	"github.com/microcosm-cc/bluemonday"
 	"hash/fnv"
+	stdhtml "html"
 	"html/template"
+	"log/slog"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jtanza/post-pigeon/internal/model"
 )
 
+const (
+	minHandleLength = 3
+	maxHandleLength = 32
+)
+
+// ErrInvalidHandle is returned when a handle can't be registered as requested
+var ErrInvalidHandle = errors.New("invalid handle")
+
 type PostManager struct {
 	db                 DB
 	cache              gcache.Cache
 	namespace          string
 	markdownExtensions parser.Extensions
+	quotas             Quotas
+	blocklist          *Blocklist
+	ctx                context.Context
 }
 
-func NewPostManager(db DB, cache gcache.Cache) PostManager {
+func NewPostManager(db DB, cache gcache.Cache, quotas Quotas) PostManager {
 	namespace := os.Getenv("POST_PIGEON_NS")
 	if len(namespace) == 0 {
-		log.Fatal("unset namespace for app")
+		Fatal("unset namespace for app")
 	}
 
 	extensions := parser.CommonExtensions | parser.AutoHeadingIDs | parser.NoEmptyLineBeforeBlock | parser.Footnotes
-	return PostManager{db, cache, namespace, extensions}
+	return PostManager{db, cache, namespace, extensions, quotas, NewBlocklist(db), context.Background()}
+}
+
+// WithContext returns a copy of pm acting on behalf of ctx, usually that of the request it's serving, so that
+// whatever it logs can be traced back to it
+func (pm PostManager) WithContext(ctx context.Context) PostManager {
+	pm.ctx = ctx
+	pm.db = pm.db.WithContext(ctx)
+	return pm
+}
+
+// NewPostCache returns the LRU cache of up to size posts a PostManager serves posts from
+func NewPostCache(size int) gcache.Cache {
+	return gcache.New(size).LRU().EvictedFunc(func(key, value interface{}) {
+		cacheEvictions.Inc()
+	}).Build()
 }
 
-func (pm PostManager) CreatePost(request model.PostRequest) (string, error) {
+// PurgeCache drops every post from the post cache, on behalf of actor
+func (pm PostManager) PurgeCache(actor string) error {
+	purged := pm.cache.Len(false)
+	pm.cache.Purge()
+	return pm.db.PersistAuditEntry(pm.newAuditEntry(AuditPurgeCache, actor, "", fmt.Sprintf("purged %d posts", purged)))
+}
+
+// Stats summarises the content of the instance
+func (pm PostManager) Stats() (*model.Stats, error) {
+	stats, err := pm.db.GetStats()
+	if err != nil {
+		return nil, err
+	}
+	stats.CachedPosts = pm.cache.Len(true)
+	return stats, nil
+}
+
+// CreatePost stores the post in request, provided it carries a valid signature. Drafts are stored unpublished,
+// to be previewed with the secret preview token of the returned post until they're published. Posts with a
+// publish_at in their front matter are scheduled, staying hidden but for their preview until then. Authors over
+// one of their quotas are turned away with a QuotaError
+func (pm PostManager) CreatePost(request model.PostRequest) (*model.Post, error) {
 	if err := ValidateSignature(request.PublicKey, request.Signature, request.Body); err != nil {
-		return "", errors.New("could not validate signature")
+		return nil, errors.New("could not validate signature")
 	}
 
-	m, err := pm.formatRequestData(request)
+	postUUID, err := GenerateDeterministicUUID(request.PublicKey, request.Title, pm.namespace)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	renderedHTML, err := toHTML("post", m)
+	fm, err := parseFrontMatter(request.Body)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	postUUID, err := GenerateDeterministicUUID(request.PublicKey, request.Title, pm.namespace)
+	fingerprint, err := Fingerprint(request.PublicKey)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	if err = pm.blocklist.checkKey(fingerprint); err != nil {
+		return nil, err
+	}
+	if err = pm.checkCurrentKey(fingerprint); err != nil {
+		return nil, err
+	}
+	if err = pm.blocklist.checkContent(request.Title, request.Body); err != nil {
+		return nil, err
 	}
 
-	if err = pm.db.PersistPost(postUUID, request, renderedHTML, ParseExpiration(request.Expiration)); err != nil {
-		return "", err
+	if len(fm.Slug) > 0 {
+		if existing, err := pm.ResolveSlug(fingerprint, fm.Slug); err != nil {
+			return nil, err
+		} else if len(existing) > 0 {
+			return nil, fmt.Errorf("%w: you have already published a post with the slug %s", ErrInvalidPost, fm.Slug)
+		}
+	}
+
+	if fm.PublishAt != nil && !fm.PublishAt.After(time.Now()) {
+		return nil, fmt.Errorf("%w: publish_at must be in the future", ErrInvalidPost)
+	}
+
+	if err = pm.quotas.check(pm.ctx, pm.db, fingerprint, len(request.Body)); err != nil {
+		return nil, err
+	}
+
+	post := model.Post{
+		UUID:        postUUID,
+		Key:         request.PublicKey,
+		Fingerprint: fingerprint,
+		Signature:   request.Signature,
+		ExpiresAt:   ParseExpiration(request.Expiration),
+		Status:      PostPublished,
+	}
+	if len(fm.Slug) > 0 {
+		post.Slug = &fm.Slug
+	}
+	if fm.PublishAt != nil || request.Draft {
+		token, err := newPreviewToken()
+		if err != nil {
+			return nil, err
+		}
+		post.PreviewToken = &token
+	}
+	if fm.PublishAt != nil {
+		// a scheduled post is dated from when it goes live, and only starts expiring from then
+		post.Status = PostScheduled
+		post.PublishAt = fm.PublishAt
+		post.CreatedAt = *fm.PublishAt
+		if post.ExpiresAt != nil {
+			expiresAt := post.ExpiresAt.Add(time.Until(*fm.PublishAt))
+			post.ExpiresAt = &expiresAt
+		}
 	}
+	if request.Draft {
+		// drafts are reaped by their age, so they're only dated from publish_at once published
+		post.Status = PostDraft
+		post.CreatedAt = time.Time{}
+	}
+
+	renderedHTML := string(pm.renderMarkdown(request.Body))
+	audit := pm.newSignedAuditEntry(AuditCreatePost, fingerprint, request.Signature, post.UUID, post.Status)
+	if err = pm.db.PersistPost(post, request, renderedHTML, fm.Tags, audit); err != nil {
+		return nil, err
+	}
+	postsCreated.Inc()
 
-	return postUUID, err
+	return &post, nil
 }
 
 func (pm PostManager) IsDuplicate(request model.PostRequest) (bool, error) {
@@ -78,16 +190,539 @@ func (pm PostManager) IsDuplicate(request model.PostRequest) (bool, error) {
 	return post != nil, nil
 }
 
+// ResolveSlug returns the uuid of the post published under slug by fingerprint, or by any other key of its author,
+// or an empty string if there is none
+func (pm PostManager) ResolveSlug(fingerprint, slug string) (string, error) {
+	history, err := pm.KeyHistory(fingerprint)
+	if err != nil {
+		return "", err
+	}
+	return pm.db.GetPostUUIDBySlug(history.Fingerprints, Slugify(slug))
+}
+
+// RegisterHandle registers the handle in request to the fingerprint of its key, provided the request carries
+// a valid signature of the handle. Handles are first come, first served and each fingerprint may hold only one
+func (pm PostManager) RegisterHandle(request model.HandleRequest) (*model.Handle, error) {
+	if err := ValidateSignature(request.PublicKey, request.Signature, request.Handle); err != nil {
+		return nil, errors.New("could not validate signature")
+	}
+
+	name := Slugify(request.Handle)
+	if len(name) < minHandleLength || len(name) > maxHandleLength {
+		return nil, fmt.Errorf("%w: handles must be between %d and %d letters, numbers or dashes", ErrInvalidHandle, minHandleLength, maxHandleLength)
+	}
+
+	fingerprint, err := Fingerprint(request.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if err = pm.checkCurrentKey(fingerprint); err != nil {
+		return nil, err
+	}
+
+	if existing, err := pm.db.GetHandle(name); err != nil {
+		return nil, err
+	} else if existing != nil {
+		return nil, fmt.Errorf("%w: the handle %s is already taken", ErrInvalidHandle, name)
+	}
+
+	if existing, err := pm.db.GetFingerprintHandle(fingerprint); err != nil {
+		return nil, err
+	} else if existing != nil {
+		return nil, fmt.Errorf("%w: your key is already registered under the handle %s", ErrInvalidHandle, existing.Handle)
+	}
+
+	handle := model.Handle{Handle: name, Fingerprint: fingerprint, Key: request.PublicKey, Signature: request.Signature}
+	if err = pm.db.PersistHandle(handle); err != nil {
+		return nil, err
+	}
+	pm.audit(pm.newSignedAuditEntry(AuditRegisterHandle, fingerprint, request.Signature, "", name))
+	return &handle, nil
+}
+
+// ResolveHandle returns the handle registered under name, if there is one
+func (pm PostManager) ResolveHandle(name string) (*model.Handle, error) {
+	return pm.db.GetHandle(Slugify(name))
+}
+
+// ClaimDomain records the claim of the key in request to a domain, provided the request carries a valid signature
+// of the domain name. Claims stay pending until the domain is found publishing the key at WellKnownPath
+func (pm PostManager) ClaimDomain(request model.DomainRequest) (*model.DomainStatement, error) {
+	if err := ValidateSignature(request.PublicKey, request.Signature, request.Domain); err != nil {
+		return nil, errors.New("could not validate signature")
+	}
+
+	domain, err := NormalizeDomain(request.Domain)
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprint, err := Fingerprint(request.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if err = pm.checkCurrentKey(fingerprint); err != nil {
+		return nil, err
+	}
+
+	claim, err := pm.db.GetDomainVerification(domain, fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	if claim == nil {
+		claim = &model.DomainVerification{Domain: domain, Fingerprint: fingerprint}
+	} else if claim.Status == DomainPending || claim.Status == DomainVerified {
+		return nil, fmt.Errorf("%w: your key has already claimed %s", ErrInvalidDomain, domain)
+	}
+
+	// failed and revoked claims start over
+	claim.Key = request.PublicKey
+	claim.Signature = request.Signature
+	claim.Status = DomainPending
+	claim.ClaimedAt = time.Now().UTC()
+	claim.CheckedAt = nil
+	claim.VerifiedAt = nil
+	if err = pm.db.SaveDomainVerification(*claim); err != nil {
+		return nil, err
+	}
+	pm.audit(pm.newSignedAuditEntry(AuditClaimDomain, fingerprint, request.Signature, "", domain))
+
+	statement := newDomainStatement(*claim)
+	return &statement, nil
+}
+
+// FetchDomainClaims returns every claim made to domain, whatever its status
+func (pm PostManager) FetchDomainClaims(domain string) ([]model.DomainStatement, error) {
+	normalized, err := NormalizeDomain(domain)
+	if err != nil {
+		// a domain we couldn't accept a claim to has no claims
+		return nil, nil
+	}
+
+	claims, err := pm.db.GetDomainVerifications(normalized)
+	if err != nil {
+		return nil, err
+	}
+
+	statements := make([]model.DomainStatement, 0, len(claims))
+	for _, c := range claims {
+		statements = append(statements, newDomainStatement(c))
+	}
+	return statements, nil
+}
+
+// VerifiedDomain returns the domain fingerprint has been verified for, or an empty string if there is none
+func (pm PostManager) VerifiedDomain(fingerprint string) (string, error) {
+	claim, err := pm.db.GetVerifiedDomain(fingerprint)
+	if err != nil || claim == nil {
+		return "", err
+	}
+	return claim.Domain, nil
+}
+
+// UpdateProfile publishes a new version of the profile of the author holding the key in request,
+// provided the request carries a valid signature of the profile document by that key
+func (pm PostManager) UpdateProfile(request model.ProfileRequest) (*model.ProfileStatement, error) {
+	if err := ValidateSignature(request.PublicKey, request.Signature, request.Document); err != nil {
+		return nil, errors.New("could not validate signature")
+	}
+
+	profile, err := parseProfileDocument(request.Document)
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprint, err := Fingerprint(request.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if err = pm.checkCurrentKey(fingerprint); err != nil {
+		return nil, err
+	}
+
+	latest, err := pm.db.GetProfile(fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	if latest != nil && profile.Version <= latest.Version {
+		return nil, fmt.Errorf("%w: version must be greater than the current version %d", ErrInvalidProfile, latest.Version)
+	}
+
+	profile.Fingerprint = fingerprint
+	profile.Key = request.PublicKey
+	profile.Signature = request.Signature
+	if err = pm.db.PersistProfile(profile); err != nil {
+		return nil, err
+	}
+	pm.audit(pm.newSignedAuditEntry(AuditUpdateProfile, fingerprint, request.Signature, "", fmt.Sprintf("version %d", profile.Version)))
+
+	statement := newProfileStatement(profile)
+	return &statement, nil
+}
+
+// FetchProfile returns the current profile of fingerprint, if they've published one
+func (pm PostManager) FetchProfile(fingerprint string) (*model.ProfileStatement, error) {
+	profile, err := pm.db.GetProfile(fingerprint)
+	if err != nil || profile == nil {
+		return nil, err
+	}
+
+	statement := newProfileStatement(*profile)
+	return &statement, nil
+}
+
+// FetchProfileHistory returns every version of the profile of fingerprint, newest first, so that
+// past profile statements can be audited
+func (pm PostManager) FetchProfileHistory(fingerprint string) ([]model.ProfileStatement, error) {
+	profiles, err := pm.db.GetProfileHistory(fingerprint)
+	if err != nil {
+		return nil, err
+	}
+
+	statements := make([]model.ProfileStatement, 0, len(profiles))
+	for _, p := range profiles {
+		statements = append(statements, newProfileStatement(p))
+	}
+	return statements, nil
+}
+
+// RotateKey records the rotation of an author from the key in request to the new key in request. Both keys must sign
+// the rotation statement, and rotations only ever extend the end of a chain: the old key must not have been rotated
+// already and the new key must not be part of another chain
+func (pm PostManager) RotateKey(request model.RotationRequest) (*model.RotationStatement, error) {
+	if err := ValidateSignature(request.PublicKey, request.Signature, request.Statement); err != nil {
+		return nil, errors.New("could not validate signature")
+	}
+	if err := ValidateSignature(request.NewPublicKey, request.NewSignature, request.Statement); err != nil {
+		return nil, errors.New("could not validate signature of the new key")
+	}
+
+	from, to, err := parseRotationStatement(request.Statement)
+	if err != nil {
+		return nil, err
+	}
+
+	fromFingerprint, err := Fingerprint(request.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	toFingerprint, err := Fingerprint(request.NewPublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if from != fromFingerprint || to != toFingerprint {
+		return nil, fmt.Errorf("%w: the statement must name the fingerprints of the keys signing it", ErrInvalidRotation)
+	}
+	if fromFingerprint == toFingerprint {
+		return nil, fmt.Errorf("%w: a key can't be rotated to itself", ErrInvalidRotation)
+	}
+
+	if err = pm.checkCurrentKey(fromFingerprint); err != nil {
+		return nil, err
+	}
+	if err = pm.checkNewKey(toFingerprint, ErrInvalidRotation); err != nil {
+		return nil, err
+	}
+	// rotating hands the posts and identity of a key over to the next, which mustn't be a way out of a ban
+	if err = pm.blocklist.checkKey(fromFingerprint); err != nil {
+		return nil, err
+	}
+	if err = pm.blocklist.checkKey(toFingerprint); err != nil {
+		return nil, err
+	}
+
+	rotation := model.KeyRotation{
+		FromFingerprint: fromFingerprint,
+		ToFingerprint:   toFingerprint,
+		FromKey:         request.PublicKey,
+		ToKey:           request.NewPublicKey,
+		Statement:       request.Statement,
+		Signature:       request.Signature,
+		NewSignature:    request.NewSignature,
+	}
+	if err = pm.db.PersistKeyRotation(rotation); err != nil {
+		return nil, err
+	}
+	pm.audit(pm.newSignedAuditEntry(AuditRotateKey, fromFingerprint, request.Signature, "", fmt.Sprintf("rotated to %s", toFingerprint)))
+
+	statement := newRotationStatement(rotation)
+	return &statement, nil
+}
+
+// RevokeKey records the revocation certificate in request, signed by the key it revokes. From then on the key can't
+// be used to publish or delete posts. A successor named by the certificate, and signing it too, takes ownership of
+// the posts of the revoked key as if it had been rotated to
+func (pm PostManager) RevokeKey(request model.RevocationRequest) (*model.RevocationStatement, error) {
+	if err := ValidateSignature(request.PublicKey, request.Signature, request.Certificate); err != nil {
+		return nil, errors.New("could not validate signature")
+	}
+
+	certificate, err := parseRevocationCertificate(request.Certificate)
+	if err != nil {
+		return nil, err
+	}
+
+	fingerprint, err := Fingerprint(request.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if certificate.Fingerprint != fingerprint {
+		return nil, fmt.Errorf("%w: the certificate must revoke the key signing it", ErrInvalidRevocation)
+	}
+
+	if existing, err := pm.db.GetRevocation(fingerprint); err != nil {
+		return nil, err
+	} else if existing != nil {
+		return nil, fmt.Errorf("%w: this key has already been revoked", ErrInvalidRevocation)
+	}
+
+	revocation := model.KeyRevocation{
+		Fingerprint: fingerprint,
+		Key:         request.PublicKey,
+		Certificate: request.Certificate,
+		Signature:   request.Signature,
+		Reason:      certificate.Reason,
+		Successor:   certificate.Successor,
+	}
+
+	var succession *model.KeyRotation
+	if len(certificate.Successor) > 0 {
+		if succession, err = pm.newSuccession(request, certificate); err != nil {
+			return nil, err
+		}
+	}
+
+	var takedown *model.AuditEntry
+	if certificate.Takedown {
+		// the posts of a rotated key belong to its successor, which a leaked retired key mustn't be able to take down
+		if rotation, err := pm.db.GetRotationFrom(fingerprint); err != nil {
+			return nil, err
+		} else if rotation != nil {
+			return nil, fmt.Errorf("%w: this key has been rotated to %s, which owns its posts", ErrInvalidRevocation, rotation.ToFingerprint)
+		}
+		entry := pm.newSignedAuditEntry(AuditDeletePost, fingerprint, request.Signature, "", "taken down along with a revoked key")
+		takedown = &entry
+	}
+
+	entry := pm.newSignedAuditEntry(AuditRevokeKey, fingerprint, request.Signature, "", certificate.Reason)
+	deleted, err := pm.db.PersistKeyRevocation(revocation, succession, entry, takedown)
+	if err != nil {
+		return nil, err
+	}
+	for _, postUUID := range deleted {
+		pm.cache.Remove(postUUID)
+	}
+	postsDeleted.Add(float64(len(deleted)))
+
+	statement := newRevocationStatement(revocation)
+	return &statement, nil
+}
+
+// newSuccession checks the successor named by a revocation certificate has signed it, and can take over the revoked key
+func (pm PostManager) newSuccession(request model.RevocationRequest, certificate revocationCertificate) (*model.KeyRotation, error) {
+	if len(request.NewPublicKey) == 0 || len(request.NewSignature) == 0 {
+		return nil, fmt.Errorf("%w: a successor must sign the certificate too", ErrInvalidRevocation)
+	}
+	if err := ValidateSignature(request.NewPublicKey, request.NewSignature, request.Certificate); err != nil {
+		return nil, errors.New("could not validate signature of the successor key")
+	}
+
+	successor, err := Fingerprint(request.NewPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if successor != certificate.Successor {
+		return nil, fmt.Errorf("%w: the successor named must be the key signing the certificate", ErrInvalidRevocation)
+	}
+	if successor == certificate.Fingerprint {
+		return nil, fmt.Errorf("%w: a key can't succeed itself", ErrInvalidRevocation)
+	}
+
+	if rotation, err := pm.db.GetRotationFrom(certificate.Fingerprint); err != nil {
+		return nil, err
+	} else if rotation != nil {
+		return nil, fmt.Errorf("%w: this key has already been rotated to %s, which owns its posts", ErrInvalidRevocation, rotation.ToFingerprint)
+	}
+	if err = pm.checkNewKey(successor, ErrInvalidRevocation); err != nil {
+		return nil, err
+	}
+	// a successor takes over the posts of the revoked key as a rotation would, so neither may be banned
+	if err = pm.blocklist.checkKey(certificate.Fingerprint); err != nil {
+		return nil, err
+	}
+	if err = pm.blocklist.checkKey(successor); err != nil {
+		return nil, err
+	}
+
+	return &model.KeyRotation{
+		FromFingerprint: certificate.Fingerprint,
+		ToFingerprint:   successor,
+		FromKey:         request.PublicKey,
+		ToKey:           request.NewPublicKey,
+		Statement:       request.Certificate,
+		Signature:       request.Signature,
+		NewSignature:    request.NewSignature,
+	}, nil
+}
+
+// FetchRevocation returns the revocation of fingerprint, if it has been revoked
+func (pm PostManager) FetchRevocation(fingerprint string) (*model.RevocationStatement, error) {
+	revocation, err := pm.db.GetRevocation(fingerprint)
+	if err != nil || revocation == nil {
+		return nil, err
+	}
+
+	statement := newRevocationStatement(*revocation)
+	return &statement, nil
+}
+
+// KeyHistory returns the chain of keys fingerprint belongs to, from the first key its author published under
+// to the key they currently use. Keys that were never rotated form a chain of their own
+func (pm PostManager) KeyHistory(fingerprint string) (model.KeyHistory, error) {
+	rotations := make([]model.KeyRotation, 0)
+
+	first := fingerprint
+	for i := 0; i < maxKeyHistory; i++ {
+		rotation, err := pm.db.GetRotationTo(first)
+		if err != nil {
+			return model.KeyHistory{}, err
+		}
+		if rotation == nil {
+			break
+		}
+		rotations = append([]model.KeyRotation{*rotation}, rotations...)
+		first = rotation.FromFingerprint
+	}
+
+	current := fingerprint
+	for i := 0; i < maxKeyHistory; i++ {
+		rotation, err := pm.db.GetRotationFrom(current)
+		if err != nil {
+			return model.KeyHistory{}, err
+		}
+		if rotation == nil {
+			break
+		}
+		rotations = append(rotations, *rotation)
+		current = rotation.ToFingerprint
+	}
+
+	history := model.KeyHistory{
+		Fingerprint:  current,
+		Fingerprints: []string{first},
+		Rotations:    make([]model.RotationStatement, 0, len(rotations)),
+		Revocations:  make([]model.RevocationStatement, 0),
+	}
+	for _, r := range rotations {
+		history.Fingerprints = append(history.Fingerprints, r.ToFingerprint)
+		history.Rotations = append(history.Rotations, newRotationStatement(r))
+	}
+
+	for _, f := range history.Fingerprints {
+		revocation, err := pm.FetchRevocation(f)
+		if err != nil {
+			return model.KeyHistory{}, err
+		}
+		if revocation != nil {
+			history.Revocations = append(history.Revocations, *revocation)
+		}
+	}
+	return history, nil
+}
+
+// checkCurrentKey returns ErrRetiredKey if fingerprint has been rotated away from or revoked, as it no longer speaks for its author
+func (pm PostManager) checkCurrentKey(fingerprint string) error {
+	rotation, err := pm.db.GetRotationFrom(fingerprint)
+	if err != nil {
+		return err
+	}
+	if rotation != nil {
+		return fmt.Errorf("%w: this key has been rotated to %s", ErrRetiredKey, rotation.ToFingerprint)
+	}
+
+	revocation, err := pm.db.GetRevocation(fingerprint)
+	if err != nil {
+		return err
+	}
+	if revocation != nil {
+		return fmt.Errorf("%w: this key has been revoked", ErrRetiredKey)
+	}
+	return nil
+}
+
+// checkNewKey returns invalid if fingerprint can't be taken on as the next key of an author,
+// because it already belongs to a chain of keys or has been revoked
+func (pm PostManager) checkNewKey(fingerprint string, invalid error) error {
+	history, err := pm.KeyHistory(fingerprint)
+	if err != nil {
+		return err
+	}
+	if len(history.Fingerprints) > 1 {
+		return fmt.Errorf("%w: the new key already belongs to another chain of keys", invalid)
+	}
+	if len(history.Revocations) > 0 {
+		return fmt.Errorf("%w: the new key has been revoked", invalid)
+	}
+	return nil
+}
+
+// identityProfile returns the profile most recently published under any of the keys in history, newest key first
+func (pm PostManager) identityProfile(history model.KeyHistory) (*model.ProfileStatement, error) {
+	for i := len(history.Fingerprints) - 1; i >= 0; i-- {
+		profile, err := pm.FetchProfile(history.Fingerprints[i])
+		if err != nil || profile != nil {
+			return profile, err
+		}
+	}
+	return nil, nil
+}
+
+// ResolveFingerprint returns the canonical fingerprint of s, given in any of the formats of FormatFingerprint,
+// or an empty string if it can't be resolved. Visual hashes are resolved against the authors of our posts, and
+// only when they match exactly one of them
+func (pm PostManager) ResolveFingerprint(s string) (string, error) {
+	fingerprint, prefix, err := parseFingerprint(s)
+	if err != nil {
+		return "", nil
+	}
+	if !prefix {
+		return fingerprint, nil
+	}
+
+	matches, err := pm.db.GetFingerprintsByPrefix(fingerprint)
+	if err != nil || len(matches) != 1 {
+		return "", err
+	}
+	return matches[0], nil
+}
+
+// HasTaggedPosts reports whether any post is tagged with tag
+func (pm PostManager) HasTaggedPosts(tag string) (bool, error) {
+	count, err := pm.db.CountTagPosts(tag)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// HasPosts reports whether the author of fingerprint has published any posts, under this or any other of their keys
 func (pm PostManager) HasPosts(fingerprint string) (bool, error) {
-	posts, err := pm.db.GetUserPosts(fingerprint)
+	history, err := pm.KeyHistory(fingerprint)
 	if err != nil {
 		return false, err
 	}
-	return len(posts) > 0, nil
+
+	count, err := pm.db.CountUserPosts(history.Fingerprints)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
 }
 
 // RemovePost will use the stored public key and post message to delete a post from the provided request
-// iff the signatures can be verified using the stored key/message.
+// iff the signatures can be verified using the stored key/message. Once the key of a post has been rotated,
+// only the current key of its author, provided with the request, can delete it
 func (pm PostManager) RemovePost(request model.PostDeleteRequest) error {
 	post, err := pm.db.GetPost(request.UUID)
 	if err != nil {
@@ -99,62 +734,397 @@ func (pm PostManager) RemovePost(request model.PostDeleteRequest) error {
 		return errors.New("could not verify signature")
 	}
 
-	content, err := pm.db.GetPostContent(post.UUID)
+	fingerprint, err := pm.authorizePostAction(post, postActionDelete, request.PublicKey, request.Signature)
 	if err != nil {
 		return err
 	}
 
+	pm.cache.Remove(post.UUID)
+	if err = pm.db.DeletePost(request, pm.newSignedAuditEntry(AuditDeletePost, fingerprint, request.Signature, post.UUID, "")); err != nil {
+		return err
+	}
+	postsDeleted.Inc()
+	return nil
+}
+
+// PublishPost makes the draft in request public, provided the request carries a signature of the draft by the
+// current key of its author, prefixed as postActionMessage describes. Drafts with a publish_at still to come are
+// scheduled instead
+func (pm PostManager) PublishPost(request model.PublishRequest) (*model.Post, error) {
+	post, err := pm.db.GetPost(request.UUID)
+	if err != nil {
+		return nil, err
+	}
+
+	if post == nil {
+		// dont leak proof of a non-existent post
+		return nil, errors.New("could not verify signature")
+	}
+
+	fingerprint, err := pm.authorizePostAction(post, postActionPublish, request.PublicKey, request.Signature)
+	if err != nil {
+		return nil, err
+	}
+	if err = pm.blocklist.checkKey(fingerprint); err != nil {
+		return nil, err
+	}
+
+	if post.Status != PostDraft {
+		return nil, fmt.Errorf("%w: post has already been published", ErrInvalidPost)
+	}
+
+	post.Status, post.CreatedAt = PostPublished, time.Now().UTC()
+	if post.PublishAt != nil && post.PublishAt.After(post.CreatedAt) {
+		post.Status, post.CreatedAt = PostScheduled, *post.PublishAt
+	} else {
+		post.PreviewToken = nil
+	}
+
+	audit := pm.newSignedAuditEntry(AuditPublishPost, fingerprint, request.Signature, post.UUID, post.Status)
+	if err = pm.db.PublishPost(post.UUID, post.Status, post.CreatedAt, audit); err != nil {
+		return nil, err
+	}
+	return post, nil
+}
+
+// FetchDraft returns the unpublished draft or scheduled post that can be previewed with token
+func (pm PostManager) FetchDraft(token string) (*model.FullPost, error) {
+	return pm.db.GetDraft(token)
+}
+
+// The actions authors take on their posts by signing them
+const (
+	postActionDelete  = "delete"
+	postActionPublish = "publish"
+)
+
+// postActionMessage returns the message to sign to take action on the post with postUUID and message. Deleting a
+// post signs its message as is, as it always has. Other actions sign it prefixed with the action and the post, e.g.
+//
+//	publish: 1b2b62db-5ea4-512d-a1a3-ff3e620a2f46
+//	# My post
+//
+// so that the signature authorising one action, which the audit log keeps, can't be used to take another
+func postActionMessage(action, postUUID, message string) string {
+	if action == postActionDelete {
+		return message
+	}
+	return fmt.Sprintf("%s: %s\n%s", action, postUUID, message)
+}
+
+// authorizePostAction checks that signature is a fresh signature of the message of post for action, see
+// postActionMessage, by the current key of its author, returning its fingerprint. publicKey is only needed once the
+// key the post was published with has been rotated
+func (pm PostManager) authorizePostAction(post *model.Post, action, publicKey, signature string) (string, error) {
+	content, err := pm.db.GetPostContent(post.UUID)
+	if err != nil {
+		return "", err
+	}
+
+	signingKey := post.Key
+	if len(publicKey) > 0 {
+		signingKey = publicKey
+	}
+
+	fingerprint, err := Fingerprint(signingKey)
+	if err != nil {
+		return "", errors.New("could not validate signature")
+	}
+
+	history, err := pm.KeyHistory(post.Fingerprint)
+	if err != nil {
+		return "", err
+	}
+	if fingerprint != history.Fingerprint {
+		if fingerprint == post.Fingerprint {
+			return "", fmt.Errorf("%w: the key of this post has been replaced, sign with the key of %s instead", ErrRetiredKey, history.Fingerprint)
+		}
+		return "", errors.New("could not validate signature")
+	}
+	if err = pm.checkCurrentKey(fingerprint); err != nil {
+		return "", err
+	}
+
 	// https://crypto.stackexchange.com/q/111536/116199
-	if err = ValidateSignature(post.Key, request.Signature, content.Message); err != nil {
-		return errors.New("could not validate signature")
+	if err = ValidateSignature(signingKey, signature, postActionMessage(action, post.UUID, content.Message)); err != nil {
+		return "", errors.New("could not validate signature")
 	}
 
-	pm.cache.Remove(post.UUID)
-	return pm.db.DeletePost(request)
+	// the creation signature is published alongside the post, so it can't double as proof of ownership
+	if IsReplayedSignature(signature, post.Signature) {
+		signatureFailures.WithLabelValues("replayed").Inc()
+		return "", errors.New("signature has already been used, re-sign the post")
+	}
+
+	return fingerprint, nil
 }
 
-func (pm PostManager) FetchPostContent(postUUID string) (*model.PostContent, error) {
+// FetchPost returns the post stored under postUUID, serving it from our cache when possible. Expired posts are
+// never served, whether or not they have been reaped yet
+func (pm PostManager) FetchPost(postUUID string) (*model.FullPost, error) {
 	if pm.cache.Has(postUUID) {
-		post, err := pm.cache.Get(postUUID)
+		cached, err := pm.cache.Get(postUUID)
 		if err != nil {
-			log.Error(err)
+			slog.ErrorContext(pm.ctx, "could not read post cache", "uuid", postUUID, "error", err)
+		} else if post := cached.(*model.FullPost); expired(post) {
+			pm.cache.Remove(postUUID)
+			return nil, nil
 		} else {
-			log.Infof("serving post %s from cache. hit rate: %f", postUUID, pm.cache.HitRate())
-			return post.(*model.PostContent), nil
+			cacheHits.Inc()
+			return post, nil
 		}
 	}
+	cacheMisses.Inc()
 
-	post, err := pm.db.GetPostContent(postUUID)
+	post, err := pm.db.GetFullPost(postUUID)
 	if err != nil {
 		return nil, err
 	}
-	if err = pm.cache.Set(postUUID, post); err != nil {
-		log.Error(err)
+	if post == nil {
+		return nil, nil
+	}
+	if post.ExpiresAt != nil {
+		err = pm.cache.SetWithExpire(postUUID, post, time.Until(*post.ExpiresAt))
+	} else {
+		err = pm.cache.Set(postUUID, post)
+	}
+	if err != nil {
+		slog.ErrorContext(pm.ctx, "could not cache post", "uuid", postUUID, "error", err)
 	}
 
 	return post, nil
 }
 
-func (pm PostManager) GetAllUserPosts(fingerprint string) (string, error) {
-	posts, err := pm.db.GetUserPosts(fingerprint)
+// ReapExpiredPosts deletes every post past its expiration, evicting them from the cache as well
+func (pm PostManager) ReapExpiredPosts() (int, error) {
+	deleted, err := pm.db.DeleteExpiredPosts(pm.newAuditEntry(AuditExpirePost, actorSystem, "", ""))
+	if err != nil {
+		return 0, err
+	}
+	for _, postUUID := range deleted {
+		pm.cache.Remove(postUUID)
+	}
+	postsExpired.Add(float64(len(deleted)))
+	return len(deleted), nil
+}
+
+func expired(post *model.FullPost) bool {
+	return post.ExpiresAt != nil && !post.ExpiresAt.After(time.Now())
+}
+
+// RenderPost returns the HTML page for post. Pages are rendered on request rather than stored so that
+// every post, whenever it was published, is served with the current template
+func (pm PostManager) RenderPost(post *model.FullPost) (string, error) {
+	m, err := pm.formatPostData(post)
+	if err != nil {
+		return "", err
+	}
+
+	handle, err := pm.db.GetFingerprintHandle(post.Fingerprint)
+	if err != nil {
+		return "", err
+	}
+	if handle != nil {
+		m["Handle"] = handle.Handle
+	}
+
+	history, err := pm.KeyHistory(post.Fingerprint)
+	if err != nil {
+		return "", err
+	}
+
+	profile, err := pm.identityProfile(history)
+	if err != nil {
+		return "", err
+	}
+	m["Profile"] = profile
+
+	for _, revocation := range history.Revocations {
+		if revocation.Fingerprint == post.Fingerprint {
+			m["Revocation"] = revocation
+		}
+	}
+
+	domain, err := pm.VerifiedDomain(post.Fingerprint)
+	if err != nil {
+		return "", err
+	}
+	m["Domain"] = domain
+	m["Draft"] = post.Status == PostDraft
+	m["Scheduled"] = post.Status == PostScheduled
+	m["PublishAt"] = post.PublishAt
+
+	return toHTML("post", m)
+}
+
+// VerifyPost checks the signature stored with a post against its key and original message
+func (pm PostManager) VerifyPost(postUUID string) (*model.SignatureVerification, error) {
+	post, err := pm.FetchPost(postUUID)
+	if err != nil || post == nil {
+		return nil, err
+	}
+
+	revocation, err := pm.db.GetRevocation(post.Fingerprint)
+	if err != nil {
+		return nil, err
+	}
+
+	verification := verifyPost(post)
+	verification.Revoked = revocation != nil
+	return &verification, nil
+}
+
+// FetchPostBundle returns the original message of a post along with the key and signature used to publish it
+func (pm PostManager) FetchPostBundle(postUUID string) (*model.PostBundle, error) {
+	post, err := pm.FetchPost(postUUID)
+	if err != nil || post == nil {
+		return nil, err
+	}
+
+	return &model.PostBundle{
+		UUID:        post.UUID,
+		Title:       post.Title,
+		Fingerprint: post.Fingerprint,
+		PublicKey:   post.Key,
+		Signature:   post.Signature,
+		Message:     post.Message,
+		CreatedAt:   post.CreatedAt,
+	}, nil
+}
+
+// PlainText renders the markdown in message and strips the result of all markup, leaving only its text
+func (pm PostManager) PlainText(message string) string {
+	text := bluemonday.StrictPolicy().SanitizeBytes(pm.renderMarkdown(message))
+	return strings.TrimSpace(stdhtml.UnescapeString(string(text)))
+}
+
+// ListUserPosts returns the page of posts described by query published by the author of fingerprint, under any of their keys
+func (pm PostManager) ListUserPosts(fingerprint string, query model.PostQuery) (*model.PostPage, error) {
+	listing, err := newPostListing(query)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := pm.KeyHistory(fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	listing.Fingerprints = history.Fingerprints
+
+	return pm.listPosts(query, listing)
+}
+
+// RenderUserPosts renders the author archive of fingerprint for a page of their posts found with query
+func (pm PostManager) RenderUserPosts(fingerprint string, query model.PostQuery, page *model.PostPage) (string, error) {
+	history, err := pm.KeyHistory(fingerprint)
+	if err != nil {
+		return "", err
+	}
+
+	profile, err := pm.identityProfile(history)
+	if err != nil {
+		return "", err
+	}
+
+	domain, err := pm.VerifiedDomain(fingerprint)
+	if err != nil {
+		return "", err
+	}
+
+	formats, err := FormatFingerprint(fingerprint)
 	if err != nil {
 		return "", err
 	}
 
-	data := make([]map[string]interface{}, 0)
-	for _, p := range posts {
+	data := map[string]interface{}{
+		"Heading":     "Author Archive",
+		"Icon":        "fa-user",
+		"Subtitle":    fingerprint,
+		"TagFilter":   true,
+		"Fingerprint": fingerprint,
+		"Profile":     profile,
+		"Rotations":   history.Rotations,
+		"Revocations": history.Revocations,
+		"Domain":      domain,
+		"Formats":     formats,
+	}
+	return renderPostListing(data, query, page)
+}
+
+// ListTagPosts returns the page of posts tagged with tag described by query
+func (pm PostManager) ListTagPosts(tag string, query model.PostQuery) (*model.PostPage, error) {
+	query.Tag = tag
+	listing, err := newPostListing(query)
+	if err != nil {
+		return nil, err
+	}
+
+	return pm.listPosts(query, listing)
+}
+
+// RenderTagPosts renders the listing of a page of posts tagged with tag, across all authors
+func (pm PostManager) RenderTagPosts(tag string, query model.PostQuery, page *model.PostPage) (string, error) {
+	// the tag is already part of the url of the listing
+	query.Tag = ""
+	data := map[string]interface{}{
+		"Heading":  "Tagged Posts",
+		"Icon":     "fa-tag",
+		"Subtitle": tag,
+	}
+	return renderPostListing(data, query, page)
+}
+
+// renderPostListing renders a page of a listing of posts into data, alongside links to sort and page through it
+func renderPostListing(data map[string]interface{}, query model.PostQuery, page *model.PostPage) (string, error) {
+	posts := make([]map[string]interface{}, 0)
+	for _, p := range page.Posts {
 		m := map[string]interface{}{
-			"Fingerprint": fingerprint,
-			"UUID":        p.UUID,
-			"Title":       p.Title,
-			"Date":        p.CreatedAt.Format(time.DateOnly),
+			"UUID":  p.UUID,
+			"Title": p.Title,
+			"Date":  p.CreatedAt.Format(time.DateOnly),
 		}
-		data = append(data, m)
+		posts = append(posts, m)
+	}
+
+	sorts := make([]map[string]interface{}, 0)
+	for _, sort := range [][2]string{{"newest", "Newest"}, {"oldest", "Oldest"}, {"title", "Title"}} {
+		sorted := query
+		sorted.Sort = sort[0]
+		sorts = append(sorts, map[string]interface{}{
+			"Label":  sort[1],
+			"Link":   pageLink(sorted, ""),
+			"Active": sort[0] == sortName(query),
+		})
+	}
+
+	data["Posts"] = posts
+	data["Query"] = query
+	data["Sort"] = sortName(query)
+	data["Sorts"] = sorts
+	if len(page.NextCursor) > 0 {
+		data["Next"] = pageLink(query, page.NextCursor)
+	}
+	if len(page.PrevCursor) > 0 {
+		data["Prev"] = pageLink(query, page.PrevCursor)
 	}
 
 	return toHTML("posts", data)
 }
 
+func (pm PostManager) listPosts(query model.PostQuery, listing PostListing) (*model.PostPage, error) {
+	// fetch an extra post to tell whether there's another page after this one
+	window := listing
+	window.Limit++
+
+	posts, err := pm.db.GetPosts(window)
+	if err != nil {
+		return nil, err
+	}
+
+	page := newPostPage(query, listing, posts)
+	return &page, nil
+}
+
 // GenerateDeterministicUUID creates a deterministic (version 5) uuid from the provided key and title
 func GenerateDeterministicUUID(key, title, namespace string) (string, error) {
 	if len(key) == 0 || len(title) == 0 {
@@ -198,34 +1168,71 @@ func ParseExpiration(expirationRequest string) *time.Time {
 	return &expiration
 }
 
-func (pm PostManager) formatRequestData(request model.PostRequest) (map[string]any, error) {
-	fingerprint, err := Fingerprint(request.PublicKey)
+func (pm PostManager) formatPostData(post *model.FullPost) (map[string]any, error) {
+	fingerprint, err := Fingerprint(post.Key)
 	if err != nil {
 		return nil, err
 	}
 
-	md := parser.NewWithExtensions(pm.markdownExtensions).Parse([]byte(request.Body))
-	renderer := html.NewRenderer(html.RendererOptions{Flags: html.CommonFlags | html.HrefTargetBlank})
-	sanitizedBody := bluemonday.UGCPolicy().SanitizeBytes(markdown.Render(md, renderer))
+	formats, err := FormatFingerprint(fingerprint)
+	if err != nil {
+		return nil, err
+	}
 
 	m := map[string]interface{}{
-		"Title":        request.Title,
-		"Body":         template.HTML(sanitizedBody),
+		"UUID":         post.UUID,
+		"Title":        post.Title,
+		"Body":         template.HTML(pm.renderMarkdown(post.Message)),
 		"Fingerprint":  fingerprint,
-		"CreationDate": time.Now().Format(time.DateOnly),
+		"CreationDate": post.CreatedAt.Format(time.DateOnly),
+		"Verification": verifyPost(post),
+		"Formats":      formats,
+		"Tags":         post.Tags,
+	}
+	if post.Slug != nil {
+		m["Slug"] = *post.Slug
 	}
 
 	return m, nil
 }
 
-func toHTML(templateName string, data any) (string, error) {
-	t, err := template.New(templateName).ParseFiles(fmt.Sprintf("templates/%s", templateName))
+func verifyPost(post *model.FullPost) model.SignatureVerification {
+	verification := VerifySignature(model.VerifyRequest{PublicKey: post.Key, Signature: post.Signature, Message: post.Message})
+	verification.UUID = post.UUID
+	if len(post.Signature) == 0 {
+		verification.Error = "post was published before signatures were stored"
+	}
+	return verification
+}
+
+// renderMarkdown parses message as markdown and returns the sanitized HTML it describes, leaving out any front matter
+func (pm PostManager) renderMarkdown(message string) []byte {
+	_, content, _ := splitFrontMatter(message)
+	md := parser.NewWithExtensions(pm.markdownExtensions).Parse([]byte(content))
+	renderer := html.NewRenderer(html.RendererOptions{Flags: html.CommonFlags | html.HrefTargetBlank})
+	return bluemonday.UGCPolicy().SanitizeBytes(markdown.Render(md, renderer))
+}
+
+// templates are the templates pages are rendered from, each named after its file
+var templates *template.Template
+
+// LoadTemplates parses every template in templates/, which pages are rendered from until the app is restarted
+func LoadTemplates() error {
+	t, err := template.ParseGlob("templates/*")
 	if err != nil {
-		return "", err
+		return fmt.Errorf("could not parse templates: %w", err)
+	}
+	templates = t
+	return nil
+}
+
+func toHTML(templateName string, data any) (string, error) {
+	if templates == nil {
+		return "", errors.New("templates not loaded")
 	}
 
 	var buf bytes.Buffer
-	if err = t.Execute(&buf, data); err != nil {
+	if err := templates.ExecuteTemplate(&buf, templateName, data); err != nil {
 		return "", err
 	}
 
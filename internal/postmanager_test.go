@@ -6,6 +6,7 @@ import (
 	"html/template"
 	"strings"
 	"testing"
+	"time"
 )
 
 const pubKey = "-----BEGIN PUBLIC KEY-----\nMIGbMBAGByqGSM49AgEGBSuBBAAjA4GGAAQAdI8T8Vfccs6rWACR3b5o3MuVkYjf\ngN2nnYAXYNC4fIVWgyfEeTYIGIjLxEB9BLquMld4Je+1vITaNQWfuRTD2HcBax6N\nRwxwcNGqwoJNWpCry9AXxRiDACkks9I2f08BIIHlOCLnPUfIWrASmuNGhyWtSUtA\nJrEKBzI+y/fyWp7z09U=\n-----END PUBLIC KEY-----"
@@ -53,14 +54,12 @@ func TestParseExpiration(t *testing.T) {
 }
 
 func TestMarkdownParses(t *testing.T) {
-	pm := NewPostManager(DB{nil}, gcache.New(1).LRU().Build())
-
-	data, err := pm.formatRequestData(model.PostRequest{
-		Title:      "Foo",
-		Body:       "# This is a title",
-		PublicKey:  pubKey,
-		Signature:  "",
-		Expiration: "",
+	pm := NewPostManager(DB{nil}, gcache.New(1).LRU().Build(), Quotas{})
+
+	data, err := pm.formatPostData(&model.FullPost{
+		Title:   "Foo",
+		Message: "# This is a title",
+		Key:     pubKey,
 	})
 	if err != nil {
 		t.Error(err)
@@ -74,14 +73,12 @@ func TestMarkdownParses(t *testing.T) {
 }
 
 func TestMarkdownClearsBuffer(t *testing.T) {
-	pm := NewPostManager(DB{nil}, gcache.New(1).LRU().Build())
-
-	data, err := pm.formatRequestData(model.PostRequest{
-		Title:      "Foo",
-		Body:       "a",
-		PublicKey:  pubKey,
-		Signature:  "",
-		Expiration: "",
+	pm := NewPostManager(DB{nil}, gcache.New(1).LRU().Build(), Quotas{})
+
+	data, err := pm.formatPostData(&model.FullPost{
+		Title:   "Foo",
+		Message: "a",
+		Key:     pubKey,
 	})
 	if err != nil {
 		t.Error(err)
@@ -93,12 +90,10 @@ func TestMarkdownClearsBuffer(t *testing.T) {
 		t.Errorf("markdown does not match expected\n got: %s wanted: %s", actual, expected)
 	}
 
-	data2, err := pm.formatRequestData(model.PostRequest{
-		Title:      "Foo",
-		Body:       "b",
-		PublicKey:  pubKey,
-		Signature:  "",
-		Expiration: "",
+	data2, err := pm.formatPostData(&model.FullPost{
+		Title:   "Foo",
+		Message: "b",
+		Key:     pubKey,
 	})
 	if err != nil {
 		t.Error(err)
@@ -110,3 +105,91 @@ func TestMarkdownClearsBuffer(t *testing.T) {
 		t.Errorf("markdown does not match expected\n got: %s wanted: %s", actual2, expected2)
 	}
 }
+
+func TestPlainText(t *testing.T) {
+	pm := NewPostManager(DB{nil}, gcache.New(1).LRU().Build(), Quotas{})
+
+	actual := pm.PlainText("# Title\n\nSome *emphasis* & a [link](https://post-pigeon.com)")
+	expected := "Title\n\nSome emphasis & a link"
+	if actual != expected {
+		t.Errorf("plain text does not match expected\n got: %q wanted: %q", actual, expected)
+	}
+}
+
+func TestFetchPostRefusesExpiredCachedPosts(t *testing.T) {
+	cache := gcache.New(1).LRU().Build()
+	pm := NewPostManager(DB{nil}, cache, Quotas{})
+
+	expiresAt := time.Now().Add(-time.Minute)
+	if err := cache.Set("uuid", &model.FullPost{UUID: "uuid", ExpiresAt: &expiresAt}); err != nil {
+		t.Fatal(err)
+	}
+
+	post, err := pm.FetchPost("uuid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post != nil {
+		t.Error("expired posts should not be served from the cache")
+	}
+	if cache.Has("uuid") {
+		t.Error("expired posts should be evicted from the cache")
+	}
+}
+
+func TestPublishSignatureCantDeletePost(t *testing.T) {
+	pm := newTestPostManager(t, newTestDB(t))
+	key := newTestKey(t)
+	body := "# draft"
+	draft, err := pm.CreatePost(model.PostRequest{Title: "draft", Body: body, PublicKey: key.publicKey, Signature: key.sign(t, body), Draft: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = pm.PublishPost(model.PublishRequest{UUID: draft.UUID, Signature: key.sign(t, body)}); err == nil {
+		t.Error("expected a signature of the draft alone to be refused for publishing it")
+	}
+
+	publishSignature := key.sign(t, "publish: "+draft.UUID+"\n"+body)
+	if _, err = pm.PublishPost(model.PublishRequest{UUID: draft.UUID, Signature: publishSignature}); err != nil {
+		t.Fatalf("could not publish draft: %v", err)
+	}
+
+	if err = pm.RemovePost(model.PostDeleteRequest{UUID: draft.UUID, Signature: publishSignature}); err == nil {
+		t.Error("expected the signature publishing a post to be refused for deleting it")
+	}
+	if err = pm.RemovePost(model.PostDeleteRequest{UUID: draft.UUID, Signature: key.sign(t, body)}); err != nil {
+		t.Errorf("could not delete post: %v", err)
+	}
+}
+
+func TestReapExpiredPostsDeletesContentAndTags(t *testing.T) {
+	db := newTestDB(t)
+	pm := newTestPostManager(t, db)
+	key := newTestKey(t)
+	expiring := createTestPost(t, pm, key, "expiring", "---\ntags: [news, go]\n---\n# expiring")
+	kept := createTestPost(t, pm, key, "kept", "---\ntags: [news]\n---\n# kept")
+
+	if err := db.db.Exec("update post set expires_at = ? where uuid = ?", time.Now().Add(-time.Minute), expiring.UUID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if reaped, err := pm.ReapExpiredPosts(); err != nil || reaped != 1 {
+		t.Fatalf("expected 1 post to be reaped got %d: %v", reaped, err)
+	}
+
+	for _, table := range []string{"post", "post_content", "post_tag"} {
+		column := "post_uuid"
+		if table == "post" {
+			column = "uuid"
+		}
+		var expired, remaining int64
+		db.db.Table(table).Where(column+" = ?", expiring.UUID).Count(&expired)
+		db.db.Table(table).Where(column+" = ?", kept.UUID).Count(&remaining)
+		if expired != 0 {
+			t.Errorf("expected the %s rows of the expired post to be deleted, %d remain", table, expired)
+		}
+		if remaining == 0 {
+			t.Errorf("expected the %s rows of the unexpired post to be kept", table)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/jtanza/post-pigeon/internal/model"
+)
+
+const (
+	maxProfileNameLength = 64
+	maxProfileBioLength  = 280
+	maxProfileLinks      = 5
+)
+
+// ErrInvalidProfile is returned when a profile document can't be published as is
+var ErrInvalidProfile = errors.New("invalid profile")
+
+// parseProfileDocument reads the fields of a profile document, a signed list of key: value lines
+//
+//	version: 1
+//	name: Jane Doe
+//	bio: Bakes bread, writes about it
+//	avatar: https://example.com/jane.png
+//	links: https://example.com, https://github.com/jane
+//
+// Versions must increase with every update to a profile, so that an old profile document
+// can't be replayed over a newer one
+func parseProfileDocument(document string) (model.Profile, error) {
+	profile := model.Profile{Document: document}
+
+	err := forEachField(document, ErrInvalidProfile, func(key, value string) error {
+		switch key {
+		case "version":
+			version, err := strconv.Atoi(value)
+			if err != nil || version < 1 {
+				return fmt.Errorf("%w: version must be a positive number", ErrInvalidProfile)
+			}
+			profile.Version = version
+		case "name":
+			if len(value) > maxProfileNameLength {
+				return fmt.Errorf("%w: name is longer than %d characters", ErrInvalidProfile, maxProfileNameLength)
+			}
+			profile.Name = value
+		case "bio":
+			if len(value) > maxProfileBioLength {
+				return fmt.Errorf("%w: bio is longer than %d characters", ErrInvalidProfile, maxProfileBioLength)
+			}
+			profile.Bio = value
+		case "avatar":
+			if err := validateProfileURL(value, "https"); err != nil {
+				return err
+			}
+			profile.Avatar = value
+		case "links":
+			links := make([]string, 0)
+			for _, link := range strings.Split(value, ",") {
+				link = strings.TrimSpace(link)
+				if len(link) == 0 {
+					continue
+				}
+				if err := validateProfileURL(link, "http", "https"); err != nil {
+					return err
+				}
+				links = append(links, link)
+			}
+			if len(links) > maxProfileLinks {
+				return fmt.Errorf("%w: profiles can have at most %d links", ErrInvalidProfile, maxProfileLinks)
+			}
+			profile.Links = strings.Join(links, "\n")
+		default:
+			return fmt.Errorf("%w: unknown profile field %q", ErrInvalidProfile, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return profile, err
+	}
+
+	if profile.Version == 0 {
+		return profile, fmt.Errorf("%w: missing version", ErrInvalidProfile)
+	}
+
+	return profile, nil
+}
+
+func validateProfileURL(raw string, schemes ...string) error {
+	u, err := url.Parse(raw)
+	if err != nil || len(u.Host) == 0 {
+		return fmt.Errorf("%w: %q is not a valid url", ErrInvalidProfile, raw)
+	}
+
+	for _, scheme := range schemes {
+		if u.Scheme == scheme {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q must be a %s url", ErrInvalidProfile, raw, strings.Join(schemes, " or "))
+}
+
+// newProfileStatement describes a stored version of a profile to clients
+func newProfileStatement(profile model.Profile) model.ProfileStatement {
+	statement := model.ProfileStatement{
+		Fingerprint: profile.Fingerprint,
+		Version:     profile.Version,
+		Name:        profile.Name,
+		Bio:         profile.Bio,
+		Avatar:      profile.Avatar,
+		PublicKey:   profile.Key,
+		Document:    profile.Document,
+		Signature:   profile.Signature,
+		CreatedAt:   profile.CreatedAt,
+	}
+	if len(profile.Links) > 0 {
+		statement.Links = strings.Split(profile.Links, "\n")
+	}
+	return statement
+}
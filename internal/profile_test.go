@@ -0,0 +1,35 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseProfileDocument(t *testing.T) {
+	profile, err := parseProfileDocument("version: 2\nname: Jane Doe\nbio: Bakes bread\navatar: https://example.com/jane.png\nlinks: https://example.com, http://jane.dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.Version != 2 || profile.Name != "Jane Doe" || profile.Bio != "Bakes bread" {
+		t.Errorf("profile fields do not match expected: %+v", profile)
+	}
+	if profile.Links != "https://example.com\nhttp://jane.dev" {
+		t.Errorf("expected links to be newline separated got %q", profile.Links)
+	}
+}
+
+func TestParseProfileDocumentRejectsInvalidFields(t *testing.T) {
+	documents := []string{
+		"name: Jane Doe",
+		"version: 0",
+		"version: 1\navatar: http://example.com/jane.png",
+		"version: 1\nlinks: ftp://example.com",
+		"version: 1\nemail: jane@example.com",
+	}
+
+	for _, document := range documents {
+		if _, err := parseProfileDocument(document); !errors.Is(err, ErrInvalidProfile) {
+			t.Errorf("expected %q to be rejected, got %v", document, err)
+		}
+	}
+}
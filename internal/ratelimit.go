@@ -0,0 +1,419 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultReadLimit   = "20/s"
+	defaultWriteLimit  = "30/m"
+	defaultCreateLimit = "10/m"
+	defaultPostsQuota  = "20/h"
+	defaultBytesQuota  = 10 << 20
+
+	// sweepInterval is how often the memory store forgets the windows that have ended
+	sweepInterval = time.Minute
+)
+
+// Limit allows up to Requests within each Window of time. A Limit of no requests doesn't limit anything
+type Limit struct {
+	Requests int
+	Window   time.Duration
+}
+
+func (l Limit) unlimited() bool {
+	return l.Requests <= 0 || l.Window <= 0
+}
+
+func (l Limit) String() string {
+	if l.unlimited() {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%d/%s", l.Requests, l.Window)
+}
+
+// ParseLimit parses limits written as requests per window, e.g. 20/s, 5/m, 100/h or 10/30s. A limit of 0
+// disables limiting altogether
+func ParseLimit(s string) (Limit, error) {
+	requests, window, ok := strings.Cut(strings.TrimSpace(s), "/")
+	if !ok {
+		if n, err := strconv.Atoi(s); err == nil && n == 0 {
+			return Limit{}, nil
+		}
+		return Limit{}, fmt.Errorf("invalid limit %q, expected requests/window", s)
+	}
+
+	n, err := strconv.Atoi(requests)
+	if err != nil || n < 0 {
+		return Limit{}, fmt.Errorf("invalid limit %q, expected requests/window", s)
+	}
+
+	switch window {
+	case "s", "m", "h":
+		window = "1" + window
+	}
+	d, err := time.ParseDuration(window)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("invalid limit %q, expected requests/window", s)
+	}
+
+	return Limit{n, d}, nil
+}
+
+// envLimit reads the limit configured through the environment variable name, falling back to fallback when
+// it's unset or invalid
+func envLimit(name, fallback string) Limit {
+	raw := os.Getenv(name)
+	if len(raw) > 0 {
+		if limit, err := ParseLimit(raw); err == nil {
+			return limit
+		}
+		slog.Warn("invalid limit, using the default", "variable", name, "value", raw, "default", fallback)
+	}
+
+	limit, err := ParseLimit(fallback)
+	if err != nil {
+		panic(err)
+	}
+	return limit
+}
+
+// IPExtractor returns how the ip of a request is told, which rate limits, challenges and the audit log all go by.
+// Unless POST_PIGEON_TRUSTED_PROXIES lists the ips or CIDR ranges of the proxies in front of the app, comma
+// separated, it's the address the request came from, as anything a client sends could be made up. Behind trusted
+// proxies, it's the ip they forwarded the request for in X-Forwarded-For
+func IPExtractor() echo.IPExtractor {
+	raw := os.Getenv("POST_PIGEON_TRUSTED_PROXIES")
+	if len(raw) == 0 {
+		return echo.ExtractIPDirect()
+	}
+
+	// only the proxies listed are trusted, rather than echo's default of any loopback or private address
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, proxy := range strings.Split(raw, ",") {
+		proxy = strings.TrimSpace(proxy)
+		if ip := net.ParseIP(proxy); ip != nil {
+			proxy = ip.String() + "/128"
+			if ip.To4() != nil {
+				proxy = ip.String() + "/32"
+			}
+		}
+		_, ipRange, err := net.ParseCIDR(proxy)
+		if err != nil {
+			slog.Warn("invalid trusted proxy, ignoring it", "value", proxy)
+			continue
+		}
+		options = append(options, echo.TrustIPRange(ipRange))
+	}
+	return echo.ExtractIPFromXFFHeader(options...)
+}
+
+// RateLimitStore counts what's done under a key within fixed windows of time, e.g. the requests of an ip or the
+// posts of a fingerprint. Stores shared between instances hold them all to the same limits
+type RateLimitStore interface {
+	// Increment counts one more request under key within the current window of length window, returning how many
+	// have been counted in it so far along with how long until it ends
+	Increment(ctx context.Context, key string, window time.Duration) (int, time.Duration, error)
+	// Count returns how many have been counted under key within the current window of length window, without
+	// counting another
+	Count(ctx context.Context, key string, window time.Duration) (int, error)
+	// Remember records key for ttl from the first time it's seen, reporting whether it had already been recorded
+	Remember(ctx context.Context, key string, ttl time.Duration) (bool, error)
+}
+
+// take counts one more request under key against limit, returning whether it's allowed and, when it isn't, how
+// long until it would be
+func take(ctx context.Context, store RateLimitStore, key string, limit Limit) (bool, time.Duration, error) {
+	if limit.unlimited() {
+		return true, 0, nil
+	}
+
+	count, reset, err := store.Increment(ctx, key, limit.Window)
+	if err != nil {
+		return false, 0, err
+	}
+	if count > limit.Requests {
+		return false, reset, nil
+	}
+	return true, 0, nil
+}
+
+// NewRateLimitStore returns the store configured through POST_PIGEON_RATE_LIMIT_STORE: memory, the default, to
+// count within this instance only, or db to share counts with every instance running against the same db
+func NewRateLimitStore(db DB) RateLimitStore {
+	switch store := strings.ToLower(os.Getenv("POST_PIGEON_RATE_LIMIT_STORE")); store {
+	case "db":
+		return NewDBRateLimitStore(db)
+	case "", "memory":
+		return NewMemoryRateLimitStore()
+	default:
+		slog.Warn("invalid POST_PIGEON_RATE_LIMIT_STORE, counting in memory", "value", store)
+		return NewMemoryRateLimitStore()
+	}
+}
+
+// windowEnd returns when the window of length window that now falls in ends
+func windowEnd(now time.Time, window time.Duration) time.Time {
+	return now.Truncate(window).Add(window)
+}
+
+type memoryWindow struct {
+	end   time.Time
+	count int
+}
+
+// MemoryRateLimitStore counts within the memory of a single instance
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	windows   map[string]memoryWindow
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{windows: map[string]memoryWindow{}, now: time.Now}
+}
+
+func (s *MemoryRateLimitStore) Increment(ctx context.Context, key string, window time.Duration) (int, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	end := windowEnd(now, window)
+	counted := s.windows[key]
+	if !counted.end.Equal(end) {
+		counted = memoryWindow{end: end}
+	}
+	counted.count++
+	s.windows[key] = counted
+
+	return counted.count, end.Sub(now), nil
+}
+
+func (s *MemoryRateLimitStore) Count(ctx context.Context, key string, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if counted := s.windows[key]; counted.end.Equal(windowEnd(s.now(), window)) {
+		return counted.count, nil
+	}
+	return 0, nil
+}
+
+func (s *MemoryRateLimitStore) Remember(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	if remembered, ok := s.windows[key]; ok && remembered.end.After(now) {
+		return true, nil
+	}
+	s.windows[key] = memoryWindow{end: now.Add(ttl), count: 1}
+	return false, nil
+}
+
+// sweep forgets the windows that have ended, so that keys that are done with don't pile up
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	for key, counted := range s.windows {
+		if !counted.end.After(now) {
+			delete(s.windows, key)
+		}
+	}
+	s.lastSweep = now
+}
+
+// DBRateLimitStore counts in the db, sharing counts between every instance running against it
+type DBRateLimitStore struct {
+	db DB
+}
+
+func NewDBRateLimitStore(db DB) DBRateLimitStore {
+	return DBRateLimitStore{db}
+}
+
+func (s DBRateLimitStore) Increment(ctx context.Context, key string, window time.Duration) (int, time.Duration, error) {
+	now := time.Now()
+	end := windowEnd(now, window)
+	count, err := s.db.WithContext(ctx).IncrementRateLimit(key, end)
+	if err != nil {
+		return 0, 0, err
+	}
+	return count, end.Sub(now), nil
+}
+
+func (s DBRateLimitStore) Count(ctx context.Context, key string, window time.Duration) (int, error) {
+	return s.db.WithContext(ctx).GetRateLimit(key, windowEnd(time.Now(), window))
+}
+
+func (s DBRateLimitStore) Remember(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	count, err := s.db.WithContext(ctx).RememberKey(key, now, now.Add(ttl))
+	if err != nil {
+		return false, err
+	}
+	return count > 1, nil
+}
+
+// RateLimits are the limits each ip is held to, by the kind of request it makes. Creating posts is held to the
+// strictest limit, anything else that writes to a stricter one than reads
+type RateLimits struct {
+	store  RateLimitStore
+	Read   Limit
+	Write  Limit
+	Create Limit
+}
+
+// NewRateLimits returns the limits configured through the environment, counted in store:
+//
+//	POST_PIGEON_RATE_LIMIT_READ    GET requests, 20/s by default
+//	POST_PIGEON_RATE_LIMIT_WRITE   any other requests, 30/m by default
+//	POST_PIGEON_RATE_LIMIT_CREATE  posts created, 10/m by default
+func NewRateLimits(store RateLimitStore) RateLimits {
+	return RateLimits{
+		store:  store,
+		Read:   envLimit("POST_PIGEON_RATE_LIMIT_READ", defaultReadLimit),
+		Write:  envLimit("POST_PIGEON_RATE_LIMIT_WRITE", defaultWriteLimit),
+		Create: envLimit("POST_PIGEON_RATE_LIMIT_CREATE", defaultCreateLimit),
+	}
+}
+
+// limit returns the kind of request c is, along with the limit it's held to
+func (l RateLimits) limit(c echo.Context) (string, Limit) {
+	switch {
+	case c.Request().Method == http.MethodPost && c.Path() == "/posts":
+		return "create", l.Create
+	case c.Request().Method == http.MethodGet || c.Request().Method == http.MethodHead:
+		return "read", l.Read
+	default:
+		return "write", l.Write
+	}
+}
+
+// middleware turns away the requests of ips over their limit with a 429, telling them when to retry. Should the
+// store fail, requests are let through rather than the app going down with it
+func (l RateLimits) middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if l.store == nil {
+				return next(c)
+			}
+
+			kind, limit := l.limit(c)
+			ctx := c.Request().Context()
+			allowed, retryAfter, err := take(ctx, l.store, fmt.Sprintf("%s:%s", kind, c.RealIP()), limit)
+			if err != nil {
+				slog.ErrorContext(ctx, "could not rate limit request", "error", err)
+				return next(c)
+			}
+			if !allowed {
+				rateLimitedRequests.Inc()
+				setRetryAfter(c, retryAfter)
+				return echo.NewHTTPError(http.StatusTooManyRequests, "Too many requests, try again later.")
+			}
+			return next(c)
+		}
+	}
+}
+
+// setRetryAfter tells the client how many seconds to wait before trying again
+func setRetryAfter(c echo.Context, retryAfter time.Duration) {
+	if retryAfter <= 0 {
+		return
+	}
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	c.Response().Header().Set(echo.HeaderRetryAfter, strconv.Itoa(seconds))
+}
+
+// ErrQuotaExceeded is returned when a fingerprint is over one of its quotas
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// QuotaError tells which quota a fingerprint is over, along with how long until it no longer is. Quotas on what's
+// stored are only freed by deleting posts, so they don't have a RetryAfter
+type QuotaError struct {
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e QuotaError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrQuotaExceeded, e.Reason)
+}
+
+func (e QuotaError) Unwrap() error {
+	return ErrQuotaExceeded
+}
+
+// Quotas hold each fingerprint to a number of posts over time, counted in store, and to a number of bytes stored
+// across all of its posts. Quotas of zero don't hold anyone to anything
+type Quotas struct {
+	store RateLimitStore
+	Posts Limit
+	Bytes int64
+}
+
+// NewQuotas returns the quotas configured through the environment, counting posts in store:
+//
+//	POST_PIGEON_QUOTA_POSTS  posts each fingerprint can create, 20/h by default
+//	POST_PIGEON_QUOTA_BYTES  bytes of markdown each fingerprint can store, 10MB by default
+func NewQuotas(store RateLimitStore) Quotas {
+	quotas := Quotas{
+		store: store,
+		Posts: envLimit("POST_PIGEON_QUOTA_POSTS", defaultPostsQuota),
+		Bytes: defaultBytesQuota,
+	}
+
+	if raw := os.Getenv("POST_PIGEON_QUOTA_BYTES"); len(raw) > 0 {
+		if bytes, err := strconv.ParseInt(raw, 10, 64); err == nil && bytes >= 0 {
+			quotas.Bytes = bytes
+		} else {
+			slog.Warn("invalid POST_PIGEON_QUOTA_BYTES, using the default", "value", raw, "default", defaultBytesQuota)
+		}
+	}
+	return quotas
+}
+
+// check ensures fingerprint can store size more bytes as a new post, counting the post against its quota of posts
+func (q Quotas) check(ctx context.Context, db DB, fingerprint string, size int) error {
+	if q.Bytes > 0 {
+		stored, err := db.GetStoredBytes(fingerprint)
+		if err != nil {
+			return err
+		}
+		if stored+int64(size) > q.Bytes {
+			quotasExceeded.WithLabelValues("bytes").Inc()
+			return QuotaError{Reason: fmt.Sprintf("your posts can't take up more than %d bytes, delete some to make room", q.Bytes)}
+		}
+	}
+
+	if q.store == nil {
+		return nil
+	}
+	allowed, retryAfter, err := take(ctx, q.store, fmt.Sprintf("posts:%s", fingerprint), q.Posts)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		quotasExceeded.WithLabelValues("posts").Inc()
+		return QuotaError{Reason: fmt.Sprintf("you can't create more than %d posts every %s", q.Posts.Requests, q.Posts.Window), RetryAfter: retryAfter}
+	}
+	return nil
+}
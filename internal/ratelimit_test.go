@@ -0,0 +1,170 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		limit    string
+		expected Limit
+		invalid  bool
+	}{
+		{"20/s", Limit{20, time.Second}, false},
+		{"5/m", Limit{5, time.Minute}, false},
+		{"100/h", Limit{100, time.Hour}, false},
+		{"10/30s", Limit{10, 30 * time.Second}, false},
+		{"0", Limit{}, false},
+		{"20", Limit{}, true},
+		{"-1/s", Limit{}, true},
+		{"20/fortnight", Limit{}, true},
+		{"20/0s", Limit{}, true},
+	}
+
+	for _, test := range tests {
+		limit, err := ParseLimit(test.limit)
+		if test.invalid {
+			if err == nil {
+				t.Errorf("expected %q to be invalid", test.limit)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("could not parse %q: %v", test.limit, err)
+		} else if limit != test.expected {
+			t.Errorf("expected %q to parse as %v got %v", test.limit, test.expected, limit)
+		}
+	}
+}
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 10, 0, time.UTC)
+	store := NewMemoryRateLimitStore()
+	store.now = func() time.Time { return now }
+	limit := Limit{2, time.Minute}
+
+	for i := 0; i < 2; i++ {
+		if allowed, _, _ := take(context.Background(), store, "a", limit); !allowed {
+			t.Fatalf("expected request %d to be allowed", i+1)
+		}
+	}
+
+	allowed, retryAfter, _ := take(context.Background(), store, "a", limit)
+	if allowed {
+		t.Fatal("expected the request over the limit to be turned away")
+	}
+	if retryAfter != 50*time.Second {
+		t.Errorf("expected to retry after the window ends in 50s got %s", retryAfter)
+	}
+
+	if allowed, _, _ := take(context.Background(), store, "b", limit); !allowed {
+		t.Error("expected keys to be limited independently")
+	}
+
+	now = now.Add(time.Minute)
+	if allowed, _, _ := take(context.Background(), store, "a", limit); !allowed {
+		t.Error("expected the count to start over in the next window")
+	}
+	if _, ok := store.windows["b"]; ok {
+		t.Error("expected ended windows to be swept")
+	}
+}
+
+func TestUnlimited(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	for i := 0; i < 100; i++ {
+		if allowed, _, _ := take(context.Background(), store, "a", Limit{}); !allowed {
+			t.Fatal("expected a limit of no requests not to limit anything")
+		}
+	}
+}
+
+func TestQuotaError(t *testing.T) {
+	var err error = QuotaError{Reason: "too many posts", RetryAfter: time.Minute}
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Error("expected quota errors to be ErrQuotaExceeded")
+	}
+
+	var quotaErr QuotaError
+	if !errors.As(err, &quotaErr) || quotaErr.RetryAfter != time.Minute {
+		t.Error("expected quota errors to carry when to retry")
+	}
+}
+
+func TestMemoryRateLimitStoreRemember(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryRateLimitStore()
+	store.now = func() time.Time { return now }
+
+	if seen, _ := store.Remember(context.Background(), "a", time.Minute); seen {
+		t.Fatal("expected a key to be new the first time it's remembered")
+	}
+	if seen, _ := store.Remember(context.Background(), "a", time.Minute); !seen {
+		t.Fatal("expected a key to be remembered")
+	}
+
+	now = now.Add(time.Minute)
+	if seen, _ := store.Remember(context.Background(), "a", time.Minute); seen {
+		t.Error("expected a key to be forgotten once its ttl is up")
+	}
+}
+
+func TestMemoryRateLimitStoreCount(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 10, 0, time.UTC)
+	store := NewMemoryRateLimitStore()
+	store.now = func() time.Time { return now }
+
+	store.Increment(context.Background(), "a", time.Minute)
+	store.Increment(context.Background(), "a", time.Minute)
+	for i := 0; i < 2; i++ {
+		if count, _ := store.Count(context.Background(), "a", time.Minute); count != 2 {
+			t.Fatalf("expected a count of 2 without counting another got %d", count)
+		}
+	}
+
+	now = now.Add(time.Minute)
+	if count, _ := store.Count(context.Background(), "a", time.Minute); count != 0 {
+		t.Errorf("expected the count to start over in the next window got %d", count)
+	}
+}
+
+func TestRateLimitsGoByTrustedIPs(t *testing.T) {
+	engine := func() *echo.Echo {
+		e := echo.New()
+		e.IPExtractor = IPExtractor()
+		e.Use(RateLimits{store: NewMemoryRateLimitStore(), Read: Limit{1, time.Minute}}.middleware())
+		e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+		return e
+	}
+	get := func(e *echo.Echo, forwardedFor string) int {
+		// httptest requests come from 192.0.2.1
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set(echo.HeaderXForwardedFor, forwardedFor)
+		recorder := httptest.NewRecorder()
+		e.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	e := engine()
+	for i, code := range []int{http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests} {
+		if got := get(e, fmt.Sprintf("203.0.113.%d", i)); got != code {
+			t.Errorf("request %d: expected a made up X-Forwarded-For not to get around the limit, expected %d got %d", i+1, code, got)
+		}
+	}
+
+	t.Setenv("POST_PIGEON_TRUSTED_PROXIES", "10.0.0.0/8, 192.0.2.1")
+	e = engine()
+	for i, code := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		if got := get(e, fmt.Sprintf("203.0.113.%d", min(i, 1))); got != code {
+			t.Errorf("request %d: expected requests from trusted proxies to be limited by the ip they were forwarded for, expected %d got %d", i+1, code, got)
+		}
+	}
+}
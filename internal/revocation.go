@@ -0,0 +1,88 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/jtanza/post-pigeon/internal/model"
+)
+
+const maxRevocationReasonLength = 280
+
+// ErrInvalidRevocation is returned when a revocation certificate can't be accepted as is
+var ErrInvalidRevocation = errors.New("invalid revocation")
+
+// revocationCertificate holds the fields of a revocation certificate, signed by the key it revokes
+//
+//	revoke: d_uUMLLYk4TrZ8tbPG82AjulQBcPBoI_TF6n-yX41KQ=
+//	reason: laptop stolen
+//	successor: 9mR1tnqJx2Q4fI2mX8D3kM1Hq1Vb0XH5Q3e_hY6q3oE=
+//	takedown: yes
+//
+// Only revoke is required. A successor takes ownership of the posts of the revoked key, and must sign the
+// certificate too. A takedown removes every post signed by the revoked key along with the revocation
+type revocationCertificate struct {
+	Fingerprint string
+	Reason      string
+	Successor   string
+	Takedown    bool
+}
+
+func parseRevocationCertificate(certificate string) (revocationCertificate, error) {
+	var rc revocationCertificate
+	err := forEachField(certificate, ErrInvalidRevocation, func(key, value string) error {
+		switch key {
+		case "revoke":
+			rc.Fingerprint = value
+		case "reason":
+			if len(value) > maxRevocationReasonLength {
+				return fmt.Errorf("%w: reason is longer than %d characters", ErrInvalidRevocation, maxRevocationReasonLength)
+			}
+			rc.Reason = value
+		case "successor":
+			rc.Successor = value
+		case "takedown":
+			takedown, err := parseYesNo(value)
+			if err != nil {
+				return fmt.Errorf("%w: takedown must be yes or no", ErrInvalidRevocation)
+			}
+			rc.Takedown = takedown
+		default:
+			return fmt.Errorf("%w: unknown certificate field %q", ErrInvalidRevocation, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return rc, err
+	}
+
+	if len(rc.Fingerprint) == 0 {
+		return rc, fmt.Errorf("%w: certificates must name the fingerprint they revoke", ErrInvalidRevocation)
+	}
+	return rc, nil
+}
+
+func parseYesNo(value string) (bool, error) {
+	switch value {
+	case "yes":
+		return true, nil
+	case "no":
+		return false, nil
+	default:
+		return strconv.ParseBool(value)
+	}
+}
+
+// newRevocationStatement describes a stored key revocation to clients
+func newRevocationStatement(revocation model.KeyRevocation) model.RevocationStatement {
+	return model.RevocationStatement{
+		Fingerprint: revocation.Fingerprint,
+		PublicKey:   revocation.Key,
+		Certificate: revocation.Certificate,
+		Signature:   revocation.Signature,
+		Reason:      revocation.Reason,
+		Successor:   revocation.Successor,
+		CreatedAt:   revocation.CreatedAt,
+	}
+}
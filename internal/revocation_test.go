@@ -0,0 +1,119 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jtanza/post-pigeon/internal/model"
+)
+
+func TestParseRevocationCertificate(t *testing.T) {
+	certificate, err := parseRevocationCertificate("revoke: abc=\nreason: laptop stolen\nsuccessor: def=\ntakedown: yes")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := revocationCertificate{Fingerprint: "abc=", Reason: "laptop stolen", Successor: "def=", Takedown: true}
+	if certificate != expected {
+		t.Errorf("certificate does not match expected\n got: %+v wanted: %+v", certificate, expected)
+	}
+}
+
+func TestParseRevocationCertificateRejectsInvalidFields(t *testing.T) {
+	certificates := []string{
+		"reason: laptop stolen",
+		"revoke: abc=\ntakedown: maybe",
+		"revoke: abc=\nexpires: never",
+	}
+
+	for _, certificate := range certificates {
+		if _, err := parseRevocationCertificate(certificate); !errors.Is(err, ErrInvalidRevocation) {
+			t.Errorf("expected %q to be rejected, got %v", certificate, err)
+		}
+	}
+}
+
+func TestRevokeRotatedKeyRefusesTakedown(t *testing.T) {
+	pm := newTestPostManager(t, newTestDB(t))
+	old, current := newTestKey(t), newTestKey(t)
+	post := createTestPost(t, pm, old, "first", "# first")
+
+	statement := fmt.Sprintf("from: %s\nto: %s", old.fingerprint, current.fingerprint)
+	_, err := pm.RotateKey(model.RotationRequest{
+		Statement:    statement,
+		PublicKey:    old.publicKey,
+		Signature:    old.sign(t, statement),
+		NewPublicKey: current.publicKey,
+		NewSignature: current.sign(t, statement),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certificate := fmt.Sprintf("revoke: %s\nreason: leaked\ntakedown: yes", old.fingerprint)
+	_, err = pm.RevokeKey(model.RevocationRequest{Certificate: certificate, PublicKey: old.publicKey, Signature: old.sign(t, certificate)})
+	if !errors.Is(err, ErrInvalidRevocation) {
+		t.Errorf("expected a rotated key to be refused taking down its posts got %v", err)
+	}
+	if fetched, err := pm.db.GetPost(post.UUID); err != nil || fetched == nil {
+		t.Errorf("expected the post to be left to the successor: %v", err)
+	}
+}
+
+func TestRevokeKeyTakesDownItsPosts(t *testing.T) {
+	pm := newTestPostManager(t, newTestDB(t))
+	key, other := newTestKey(t), newTestKey(t)
+	posts := []*model.Post{createTestPost(t, pm, key, "first", "# first"), createTestPost(t, pm, key, "second", "# second")}
+	kept := createTestPost(t, pm, other, "kept", "# kept")
+	for _, post := range posts {
+		if _, err := pm.FetchPost(post.UUID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	certificate := fmt.Sprintf("revoke: %s\nreason: leaked\ntakedown: yes", key.fingerprint)
+	if _, err := pm.RevokeKey(model.RevocationRequest{Certificate: certificate, PublicKey: key.publicKey, Signature: key.sign(t, certificate)}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, post := range posts {
+		if fetched, err := pm.db.GetPost(post.UUID); err != nil || fetched != nil {
+			t.Errorf("expected the posts of the revoked key to be taken down got %+v: %v", fetched, err)
+		}
+		if pm.cache.Has(post.UUID) {
+			t.Error("expected the posts taken down to be dropped from the cache")
+		}
+		if entries := auditEntries(t, pm, AuditDeletePost, post.UUID); len(entries) != 1 || entries[0].Actor != key.fingerprint {
+			t.Errorf("expected the takedown of %s to be audited once got %+v", post.UUID, entries)
+		}
+	}
+	if fetched, err := pm.db.GetPost(kept.UUID); err != nil || fetched == nil {
+		t.Errorf("expected the posts of other keys to be left up: %v", err)
+	}
+	if entries := auditEntries(t, pm, AuditRevokeKey, ""); len(entries) != 1 || entries[0].Actor != key.fingerprint {
+		t.Errorf("expected the revocation to be audited once got %+v", entries)
+	}
+}
+
+func TestRevokeKeyIsAuditedInItsTransaction(t *testing.T) {
+	db := newTestDB(t)
+	pm := newTestPostManager(t, db)
+	key := newTestKey(t)
+	post := createTestPost(t, pm, key, "post", "# post")
+
+	if err := db.db.Exec("drop table audit_entry").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	certificate := fmt.Sprintf("revoke: %s\nreason: leaked\ntakedown: yes", key.fingerprint)
+	if _, err := pm.RevokeKey(model.RevocationRequest{Certificate: certificate, PublicKey: key.publicKey, Signature: key.sign(t, certificate)}); err == nil {
+		t.Error("expected a revocation that couldn't be audited to fail")
+	}
+	if revocation, err := db.GetRevocation(key.fingerprint); err != nil || revocation != nil {
+		t.Errorf("expected a revocation that couldn't be audited not to be recorded got %+v: %v", revocation, err)
+	}
+	if fetched, err := db.GetPost(post.UUID); err != nil || fetched == nil {
+		t.Errorf("expected a revocation that couldn't be audited to leave the posts up: %v", err)
+	}
+}
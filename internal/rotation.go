@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jtanza/post-pigeon/internal/model"
+)
+
+// maxKeyHistory bounds how far back and forward we walk the chain of rotations of a key
+const maxKeyHistory = 64
+
+// ErrInvalidRotation is returned when a key rotation statement can't be accepted as is
+var ErrInvalidRotation = errors.New("invalid key rotation")
+
+// ErrRetiredKey is returned when a key that no longer speaks for its author is used to act on their behalf
+var ErrRetiredKey = errors.New("retired key")
+
+// parseRotationStatement reads the fingerprints named by a key rotation statement
+//
+//	from: d_uUMLLYk4TrZ8tbPG82AjulQBcPBoI_TF6n-yX41KQ=
+//	to: 9mR1tnqJx2Q4fI2mX8D3kM1Hq1Vb0XH5Q3e_hY6q3oE=
+//
+// The same statement is signed by both keys, so neither can be bound to the other without its holder's consent
+func parseRotationStatement(statement string) (string, string, error) {
+	var from, to string
+	err := forEachField(statement, ErrInvalidRotation, func(key, value string) error {
+		switch key {
+		case "from":
+			from = value
+		case "to":
+			to = value
+		default:
+			return fmt.Errorf("%w: unknown statement field %q", ErrInvalidRotation, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	if len(from) == 0 || len(to) == 0 {
+		return "", "", fmt.Errorf("%w: statements must name the fingerprints rotated from and to", ErrInvalidRotation)
+	}
+	return from, to, nil
+}
+
+// newRotationStatement describes a stored key rotation to clients
+func newRotationStatement(rotation model.KeyRotation) model.RotationStatement {
+	return model.RotationStatement{
+		FromFingerprint: rotation.FromFingerprint,
+		ToFingerprint:   rotation.ToFingerprint,
+		FromPublicKey:   rotation.FromKey,
+		ToPublicKey:     rotation.ToKey,
+		Statement:       rotation.Statement,
+		Signature:       rotation.Signature,
+		NewSignature:    rotation.NewSignature,
+		CreatedAt:       rotation.CreatedAt,
+	}
+}
@@ -0,0 +1,31 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseRotationStatement(t *testing.T) {
+	from, to, err := parseRotationStatement("from: abc=\nto: def=\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if from != "abc=" || to != "def=" {
+		t.Errorf("fingerprints do not match expected, got from: %s to: %s", from, to)
+	}
+}
+
+func TestParseRotationStatementRejectsIncompleteStatements(t *testing.T) {
+	statements := []string{
+		"from: abc=",
+		"to: def=",
+		"from: abc=\nto: def=\nreason: lost",
+		"abc= def=",
+	}
+
+	for _, statement := range statements {
+		if _, _, err := parseRotationStatement(statement); !errors.Is(err, ErrInvalidRotation) {
+			t.Errorf("expected %q to be rejected, got %v", statement, err)
+		}
+	}
+}
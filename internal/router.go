@@ -2,20 +2,25 @@ package internal
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"github.com/go-playground/validator/v10"
 	"github.com/jtanza/post-pigeon/internal/model"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"golang.org/x/crypto/acme/autocert"
-	"html/template"
 	"io"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
 )
 
-const maxFileSize = 15000
+const (
+	maxFileSize      = 15000
+	mimeTextMarkdown = "text/markdown; charset=UTF-8"
+)
 
 type CustomValidator struct {
 	validator *validator.Validate
@@ -31,14 +36,20 @@ func (cv *CustomValidator) Validate(i interface{}) error {
 type Router struct {
 	db          DB
 	postManager PostManager
+	health      Health
+	rateLimits  RateLimits
+	challenges  Challenges
 }
 
-func NewRouter(db DB, postCreator PostManager) Router {
-	return Router{db, postCreator}
+func NewRouter(db DB, postCreator PostManager, health Health, rateLimits RateLimits, challenges Challenges) Router {
+	return Router{db, postCreator, health, rateLimits, challenges}
 }
 
-func (r Router) Engine(logFile *os.File) *echo.Echo {
+func (r Router) Engine() *echo.Echo {
 	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+	e.IPExtractor = IPExtractor()
 
 	if strings.EqualFold(os.Getenv("POST_PIGEON_ENV"), "prod") {
 		e.AutoTLSManager.HostPolicy = autocert.HostWhitelist("post-pigeon.com", "www.post-pigeon.com")
@@ -46,13 +57,23 @@ func (r Router) Engine(logFile *os.File) *echo.Echo {
 		e.Pre(middleware.HTTPSRedirect())
 	}
 
-	e.Use(middleware.LoggerWithConfig(middleware.LoggerConfig{Output: logFile}))
-	e.Use(middleware.RateLimiter(middleware.NewRateLimiterMemoryStore(20)))
+	e.Use(requestIDMiddleware())
+	e.Use(requestLogger())
+	e.Use(auditMiddleware())
+	e.Use(metricsMiddleware)
+	e.Use(r.rateLimits.middleware())
 
 	e.Validator = &CustomValidator{validator: validator.New()}
 
 	e.HTTPErrorHandler = customHTTPErrorHandler
 
+	if !MetricsOnAdmin() {
+		e.GET("/metrics", serveMetrics)
+	}
+	e.GET("/healthz", r.health.getHealth)
+	e.GET("/readyz", r.health.getReadiness)
+	e.GET("/version", r.health.getVersion)
+
 	e.Static("/public", "./public")
 	e.File("/", "public/index.html")
 	e.File("/new", "public/new.html")
@@ -60,27 +81,195 @@ func (r Router) Engine(logFile *os.File) *echo.Echo {
 	e.File("/search/users", "public/user.html")
 
 	e.GET("/posts/:uuid", r.getPost)
+	e.GET("/posts/:uuid/bundle", r.getPostBundle)
+	e.GET("/posts/:uuid/verify", r.verifyPost)
+	e.POST("/posts/:uuid/reports", r.reportPost)
 	e.POST("/posts", r.createPost)
+	e.GET("/challenges", r.challenges.getChallenge)
 	e.DELETE("/posts", r.deletePost)
 
+	e.GET("/drafts/:token", r.getDraft)
+	e.File("/publish", "public/publish.html")
+	e.POST("/publish", r.publishPost)
+
+	e.POST("/verify", r.verifySignature)
+
 	e.POST("/users", r.getUserFingerprint)
 	e.GET("/users/:fingerprint", r.getUserPosts)
+	e.GET("/users/:fingerprint/:slug", r.getUserPost)
+
+	e.GET("/exports/:fingerprint", r.exportPosts)
+
+	e.GET("/fingerprints/:fingerprint", r.getFingerprintFormats)
+
+	e.File("/handles", "public/handle.html")
+	e.POST("/handles", r.registerHandle)
+	e.GET("/handles/:handle", r.getHandlePosts)
+	e.GET("/handles/:handle/:slug", r.getHandlePost)
+
+	e.GET("/tags/:tag", r.getTagPosts)
+
+	e.File("/profiles", "public/profile.html")
+	e.POST("/profiles", r.updateProfile)
+	e.GET("/profiles/:fingerprint", r.getProfile)
+	e.GET("/profiles/:fingerprint/history", r.getProfileHistory)
+
+	e.File("/rotations", "public/rotation.html")
+	e.POST("/rotations", r.rotateKey)
+	e.GET("/rotations/:fingerprint", r.getKeyHistory)
+
+	e.File("/domains", "public/domain.html")
+	e.POST("/domains", r.claimDomain)
+	e.GET("/domains/:domain", r.getDomainClaims)
+
+	e.File("/revocations", "public/revocation.html")
+	e.POST("/revocations", r.revokeKey)
+	e.GET("/revocations/:fingerprint", r.getRevocation)
 
 	return e
 }
 
+// manager returns the PostManager that serves the request in c
+func (r Router) manager(c echo.Context) PostManager {
+	return r.postManager.WithContext(c.Request().Context())
+}
+
 func (r Router) getPost(c echo.Context) error {
-	id := c.Param("uuid")
+	id, format := postFormat(c, c.Param("uuid"))
+	return r.servePost(c, id, format)
+}
+
+// getUserPost serves the post its author published under the requested slug
+func (r Router) getUserPost(c echo.Context) error {
+	slug, format := postFormat(c, c.Param("slug"))
+
+	fingerprint, err := r.manager(c).ResolveFingerprint(fingerprintParam(c))
+	if err != nil {
+		return err
+	}
+	if len(fingerprint) == 0 {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+
+	postUUID, err := r.manager(c).ResolveSlug(fingerprint, slug)
+	if err != nil {
+		return err
+	}
+	if len(postUUID) == 0 {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+
+	return r.servePost(c, postUUID, format)
+}
+
+// servePost writes the post identified by postUUID in the requested format
+func (r Router) servePost(c echo.Context, postUUID, format string) error {
+	post, err := r.manager(c).FetchPost(postUUID)
+	if err != nil {
+		return err
+	}
+	if post == nil {
+		return r.postNotFound(c, postUUID)
+	}
+
+	switch format {
+	case "md":
+		return c.Blob(http.StatusOK, mimeTextMarkdown, []byte(post.Message))
+	case "txt":
+		return c.String(http.StatusOK, r.manager(c).PlainText(post.Message))
+	case "":
+		page, err := r.manager(c).RenderPost(post)
+		if err != nil {
+			return err
+		}
+		return c.HTML(http.StatusOK, page)
+	default:
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+}
+
+// postNotFound tells posts taken down by the operators apart from those that don't exist, or were deleted by their authors
+func (r Router) postNotFound(c echo.Context, postUUID string) error {
+	takedown, err := r.manager(c).FetchTakedown(postUUID)
+	if err != nil {
+		return err
+	}
+	if takedown == nil {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+
+	message := "This post was taken down by the operators of this instance"
+	if takedown.TakedownReason != nil {
+		message = fmt.Sprintf("%s: %s", message, *takedown.TakedownReason)
+	}
+	return echo.NewHTTPError(http.StatusUnavailableForLegalReasons, message)
+}
+
+// reportPost flags a post for the operators to look into
+func (r Router) reportPost(c echo.Context) error {
+	var request model.ReportRequest
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
 
-	postContent, err := r.postManager.FetchPostContent(id)
+	if err := c.Validate(request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "One or more fields missing or incorrect")
+	}
+
+	report, err := r.manager(c).ReportPost(c.Param("uuid"), request)
 	if err != nil {
 		return err
 	}
-	if postContent == nil {
+	if report == nil {
 		return echo.NewHTTPError(http.StatusNotFound)
 	}
 
-	return c.HTML(http.StatusOK, postContent.HTML)
+	page, err := toHTML("reported", map[string]any{"UUID": report.PostUUID})
+	if err != nil {
+		return err
+	}
+	return c.HTML(http.StatusCreated, page)
+}
+
+func (r Router) getPostBundle(c echo.Context) error {
+	bundle, err := r.manager(c).FetchPostBundle(c.Param("uuid"))
+	if err != nil {
+		return err
+	}
+	if bundle == nil {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+
+	return c.JSONPretty(http.StatusOK, bundle, "  ")
+}
+
+func (r Router) verifyPost(c echo.Context) error {
+	verification, err := r.manager(c).VerifyPost(c.Param("uuid"))
+	if err != nil {
+		return err
+	}
+	if verification == nil {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+
+	return c.JSONPretty(http.StatusOK, verification, "  ")
+}
+
+func (r Router) verifySignature(c echo.Context) error {
+	var request model.VerifyRequest
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := c.Validate(request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "One or more fields missing or incorrect")
+	}
+
+	if len(request.Message) >= maxFileSize {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("message size exceeds limit of %d bytes", maxFileSize))
+	}
+
+	return c.JSONPretty(http.StatusOK, VerifySignature(request), "  ")
 }
 
 func (r Router) createPost(c echo.Context) error {
@@ -93,6 +282,13 @@ func (r Router) createPost(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "One or more fields missing or incorrect")
 	}
 
+	// proofs of work are checked first, as they're the cheapest to check and the costliest to forge
+	if err := r.challenges.Verify(c.Request().Context(), request.Challenge, request.Proof, request.Title, request.Signature); errors.Is(err, ErrInvalidProof) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	} else if err != nil {
+		return err
+	}
+
 	body, err := readFile(c)
 	if err != nil {
 		return err
@@ -102,18 +298,82 @@ func (r Router) createPost(c echo.Context) error {
 	}
 	request.Body = body
 
-	if dupe, err := r.postManager.IsDuplicate(request); err != nil {
+	if dupe, err := r.manager(c).IsDuplicate(request); err != nil {
 		return err
 	} else if dupe {
 		return echo.NewHTTPError(http.StatusBadRequest, "Duplicate posts (same author, same title) are not allowed.")
 	}
 
-	uuid, err := r.postManager.CreatePost(request)
+	post, err := r.manager(c).CreatePost(request)
+	var quotaErr QuotaError
+	if errors.Is(err, ErrInvalidPost) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	} else if errors.Is(err, ErrBannedKey) || errors.Is(err, ErrBlockedContent) {
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	} else if errors.As(err, &quotaErr) {
+		setRetryAfter(c, quotaErr.RetryAfter)
+		return echo.NewHTTPError(http.StatusTooManyRequests, err.Error())
+	} else if errors.Is(err, ErrRetiredKey) {
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	} else if err != nil {
+		return err
+	}
+
+	// the post is up whether or not it's counted, it only goes towards making challenges harder for its ip, which
+	// is told by IPExtractor lest X-Forwarded-For be made up to dodge them
+	if err = r.challenges.Created(c.Request().Context(), c.RealIP()); err != nil {
+		slog.ErrorContext(c.Request().Context(), "could not count post created", "error", err)
+	}
+
+	if post.PreviewToken != nil {
+		return c.Redirect(http.StatusSeeOther, fmt.Sprintf("drafts/%s", *post.PreviewToken))
+	}
+	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("posts/%s", post.UUID))
+}
+
+// getDraft serves the preview of an unpublished draft or scheduled post to whoever holds its secret preview link
+func (r Router) getDraft(c echo.Context) error {
+	draft, err := r.manager(c).FetchDraft(c.Param("token"))
+	if err != nil {
+		return err
+	}
+	if draft == nil {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+
+	page, err := r.manager(c).RenderPost(draft)
 	if err != nil {
 		return err
 	}
 
-	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("posts/%s", uuid))
+	c.Response().Header().Set("X-Robots-Tag", "noindex")
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	return c.HTML(http.StatusOK, page)
+}
+
+func (r Router) publishPost(c echo.Context) error {
+	var request model.PublishRequest
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := c.Validate(request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "One or more fields missing or incorrect")
+	}
+
+	post, err := r.manager(c).PublishPost(request)
+	if errors.Is(err, ErrInvalidPost) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	} else if errors.Is(err, ErrRetiredKey) || errors.Is(err, ErrBannedKey) {
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	} else if err != nil {
+		return err
+	}
+
+	if post.PreviewToken != nil {
+		return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/drafts/%s", *post.PreviewToken))
+	}
+	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/posts/%s", post.UUID))
 }
 
 func (r Router) deletePost(c echo.Context) error {
@@ -126,23 +386,87 @@ func (r Router) deletePost(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "One or more fields missing or incorrect")
 	}
 
-	if err := r.postManager.RemovePost(request); err != nil {
+	if err := r.manager(c).RemovePost(request); errors.Is(err, ErrRetiredKey) {
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	} else if err != nil {
 		return err
 	}
 
 	return c.Redirect(http.StatusSeeOther, "/new")
 }
 
+// exportPosts serves every public post of an author as an archive, see PostManager.ExportPosts
+func (r Router) exportPosts(c echo.Context) error {
+	fingerprint, err := r.manager(c).ResolveFingerprint(fingerprintParam(c))
+	if err != nil {
+		return err
+	}
+	if len(fingerprint) == 0 {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+
+	var archive bytes.Buffer
+	if exported, err := r.manager(c).ExportPosts(fingerprint, &archive); err != nil {
+		return err
+	} else if !exported {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=post-pigeon-%s.tar.gz", fingerprint))
+	return c.Blob(http.StatusOK, "application/gzip", archive.Bytes())
+}
+
 func (r Router) getUserPosts(c echo.Context) error {
-	id := c.Param("fingerprint")
+	id := fingerprintParam(c)
 
-	if exists, err := r.postManager.HasPosts(id); err != nil {
+	fingerprint, err := r.manager(c).ResolveFingerprint(id)
+	if err != nil {
+		return err
+	}
+	if len(fingerprint) == 0 {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+
+	// archives are listed under the canonical fingerprint of the current key of their author
+	history, err := r.manager(c).KeyHistory(fingerprint)
+	if err != nil {
+		return err
+	}
+	if history.Fingerprint != id {
+		location := fmt.Sprintf("/users/%s", history.Fingerprint)
+		if len(c.QueryString()) > 0 {
+			location += "?" + c.QueryString()
+		}
+		return c.Redirect(http.StatusFound, location)
+	}
+
+	var query model.PostQuery
+	if err := c.Bind(&query); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := c.Validate(query); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "One or more query parameters incorrect")
+	}
+
+	if exists, err := r.manager(c).HasPosts(id); err != nil {
 		return err
 	} else if !exists {
 		return echo.NewHTTPError(http.StatusNotFound)
 	}
 
-	posts, err := r.postManager.GetAllUserPosts(id)
+	page, err := r.manager(c).ListUserPosts(id, query)
+	if errors.Is(err, ErrInvalidQuery) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	} else if err != nil {
+		return err
+	}
+
+	if wantsJSON(c) {
+		return c.JSONPretty(http.StatusOK, page, "  ")
+	}
+
+	posts, err := r.manager(c).RenderUserPosts(id, query, page)
 	if err != nil {
 		return err
 	}
@@ -150,8 +474,63 @@ func (r Router) getUserPosts(c echo.Context) error {
 	return c.HTML(http.StatusOK, posts)
 }
 
-func (r Router) getUserFingerprint(c echo.Context) error {
-	var request model.UserRequest
+func (r Router) getTagPosts(c echo.Context) error {
+	tag := Slugify(c.Param("tag"))
+
+	var query model.PostQuery
+	if err := c.Bind(&query); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := c.Validate(query); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "One or more query parameters incorrect")
+	}
+
+	if exists, err := r.manager(c).HasTaggedPosts(tag); err != nil {
+		return err
+	} else if !exists {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+
+	page, err := r.manager(c).ListTagPosts(tag, query)
+	if errors.Is(err, ErrInvalidQuery) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	} else if err != nil {
+		return err
+	}
+
+	if wantsJSON(c) {
+		return c.JSONPretty(http.StatusOK, page, "  ")
+	}
+
+	posts, err := r.manager(c).RenderTagPosts(tag, query, page)
+	if err != nil {
+		return err
+	}
+
+	return c.HTML(http.StatusOK, posts)
+}
+
+// getFingerprintFormats serves every rendering of the requested fingerprint, given in any of them
+func (r Router) getFingerprintFormats(c echo.Context) error {
+	fingerprint, err := r.manager(c).ResolveFingerprint(fingerprintParam(c))
+	if err != nil {
+		return err
+	}
+	if len(fingerprint) == 0 {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+
+	formats, err := FormatFingerprint(fingerprint)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+
+	return c.JSONPretty(http.StatusOK, formats, "  ")
+}
+
+func (r Router) registerHandle(c echo.Context) error {
+	var request model.HandleRequest
 	if err := c.Bind(&request); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
@@ -160,26 +539,262 @@ func (r Router) getUserFingerprint(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "One or more fields missing or incorrect")
 	}
 
-	fingerprint, err := Fingerprint(request.PublicKey)
+	handle, err := r.manager(c).RegisterHandle(request)
+	if errors.Is(err, ErrInvalidHandle) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	} else if errors.Is(err, ErrRetiredKey) {
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	} else if err != nil {
+		return err
+	}
+
+	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/users/%s", handle.Fingerprint))
+}
+
+// getHandlePosts redirects to the author archive of the fingerprint registered under the requested handle
+func (r Router) getHandlePosts(c echo.Context) error {
+	handle, err := r.manager(c).ResolveHandle(c.Param("handle"))
 	if err != nil {
+		return err
+	}
+	if handle == nil {
 		return echo.NewHTTPError(http.StatusNotFound)
 	}
 
-	if exists, err := r.postManager.HasPosts(fingerprint); err != nil {
+	location := fmt.Sprintf("/users/%s", handle.Fingerprint)
+	if len(c.QueryString()) > 0 {
+		location += "?" + c.QueryString()
+	}
+	return c.Redirect(http.StatusFound, location)
+}
+
+// getHandlePost serves the post published under the requested slug by the fingerprint registered under the requested handle
+func (r Router) getHandlePost(c echo.Context) error {
+	handle, err := r.manager(c).ResolveHandle(c.Param("handle"))
+	if err != nil {
 		return err
-	} else if !exists {
+	}
+	if handle == nil {
 		return echo.NewHTTPError(http.StatusNotFound)
 	}
 
-	posts, err := r.postManager.GetAllUserPosts(fingerprint)
+	slug, format := postFormat(c, c.Param("slug"))
+	postUUID, err := r.manager(c).ResolveSlug(handle.Fingerprint, slug)
 	if err != nil {
 		return err
 	}
+	if len(postUUID) == 0 {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
 
-	return c.HTML(http.StatusOK, posts)
+	return r.servePost(c, postUUID, format)
+}
+
+func (r Router) updateProfile(c echo.Context) error {
+	var request model.ProfileRequest
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := c.Validate(request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "One or more fields missing or incorrect")
+	}
+
+	document, err := readFile(c)
+	if err != nil {
+		return err
+	}
+	if len(document) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Empty profile on request")
+	}
+	request.Document = document
+
+	profile, err := r.manager(c).UpdateProfile(request)
+	if errors.Is(err, ErrInvalidProfile) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	} else if errors.Is(err, ErrRetiredKey) {
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	} else if err != nil {
+		return err
+	}
+
+	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/users/%s", profile.Fingerprint))
+}
+
+func (r Router) getProfile(c echo.Context) error {
+	profile, err := r.manager(c).FetchProfile(c.Param("fingerprint"))
+	if err != nil {
+		return err
+	}
+	if profile == nil {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+
+	return c.JSONPretty(http.StatusOK, profile, "  ")
+}
+
+func (r Router) getProfileHistory(c echo.Context) error {
+	profiles, err := r.manager(c).FetchProfileHistory(c.Param("fingerprint"))
+	if err != nil {
+		return err
+	}
+	if len(profiles) == 0 {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+
+	return c.JSONPretty(http.StatusOK, profiles, "  ")
+}
+
+func (r Router) rotateKey(c echo.Context) error {
+	var request model.RotationRequest
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := c.Validate(request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "One or more fields missing or incorrect")
+	}
+
+	statement, err := readFile(c)
+	if err != nil {
+		return err
+	}
+	if len(statement) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Empty statement on request")
+	}
+	request.Statement = statement
+
+	rotation, err := r.manager(c).RotateKey(request)
+	if errors.Is(err, ErrInvalidRotation) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	} else if errors.Is(err, ErrRetiredKey) || errors.Is(err, ErrBannedKey) {
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	} else if err != nil {
+		return err
+	}
+
+	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/users/%s", rotation.ToFingerprint))
+}
+
+// getKeyHistory serves the chain of keys the requested fingerprint belongs to, with every signed rotation statement
+func (r Router) getKeyHistory(c echo.Context) error {
+	history, err := r.manager(c).KeyHistory(c.Param("fingerprint"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSONPretty(http.StatusOK, history, "  ")
+}
+
+func (r Router) claimDomain(c echo.Context) error {
+	var request model.DomainRequest
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := c.Validate(request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "One or more fields missing or incorrect")
+	}
+
+	claim, err := r.manager(c).ClaimDomain(request)
+	if errors.Is(err, ErrInvalidDomain) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	} else if errors.Is(err, ErrRetiredKey) {
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	} else if err != nil {
+		return err
+	}
+
+	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/domains/%s", claim.Domain))
+}
+
+// getDomainClaims serves the claims made to the requested domain and where each stands
+func (r Router) getDomainClaims(c echo.Context) error {
+	claims, err := r.manager(c).FetchDomainClaims(c.Param("domain"))
+	if err != nil {
+		return err
+	}
+	if len(claims) == 0 {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+
+	return c.JSONPretty(http.StatusOK, claims, "  ")
+}
+
+func (r Router) revokeKey(c echo.Context) error {
+	var request model.RevocationRequest
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := c.Validate(request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "One or more fields missing or incorrect")
+	}
+
+	certificate, err := readFile(c)
+	if err != nil {
+		return err
+	}
+	if len(certificate) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Empty certificate on request")
+	}
+	request.Certificate = certificate
+
+	revocation, err := r.manager(c).RevokeKey(request)
+	if errors.Is(err, ErrInvalidRevocation) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	} else if errors.Is(err, ErrBannedKey) {
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	} else if err != nil {
+		return err
+	}
+
+	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/revocations/%s", revocation.Fingerprint))
 }
 
+func (r Router) getRevocation(c echo.Context) error {
+	revocation, err := r.manager(c).FetchRevocation(c.Param("fingerprint"))
+	if err != nil {
+		return err
+	}
+	if revocation == nil {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+
+	return c.JSONPretty(http.StatusOK, revocation, "  ")
+}
+
+func (r Router) getUserFingerprint(c echo.Context) error {
+	var request model.UserRequest
+	if err := c.Bind(&request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := c.Validate(request); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "One or more fields missing or incorrect")
+	}
+
+	fingerprint, err := Fingerprint(request.PublicKey)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+
+	if exists, err := r.manager(c).HasPosts(fingerprint); err != nil {
+		return err
+	} else if !exists {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+
+	return c.Redirect(http.StatusSeeOther, fmt.Sprintf("/users/%s", fingerprint))
+}
+
+// customHTTPErrorHandler renders errors as HTML pages. The request logger hands errors over as soon as they're
+// returned, so by the time echo does, the response has already been written
 func customHTTPErrorHandler(e error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
 	errorMessage := e.Error()
 	code := http.StatusInternalServerError
 	if he, ok := e.(*echo.HTTPError); ok {
@@ -190,35 +805,50 @@ func customHTTPErrorHandler(e error, c echo.Context) {
 		}
 		code = he.Code
 	}
-	c.Logger().Warn(e)
 
 	h, err := errorHTML(errorMessage, code)
 	if err != nil {
-		c.Logger().Error(err)
+		slog.ErrorContext(c.Request().Context(), "could not render error page", "error", err)
 	}
 
 	if err = c.HTML(code, h); err != nil {
-		c.Logger().Error(err)
+		slog.ErrorContext(c.Request().Context(), "could not write error page", "error", err)
 	}
 }
 
 func errorHTML(e string, code int) (string, error) {
-	t, err := template.New("error").ParseFiles("templates/error")
-	if err != nil {
-		return "", err
-	}
-
 	m := map[string]interface{}{
 		"Error":  e,
 		"Status": code,
 	}
+	return toHTML("error", m)
+}
+
+// postFormat splits the requested post id from any extension naming the format it should be served in,
+// e.g. /posts/{uuid}.md. Without an extension, clients can ask for the markdown source via their Accept header
+func postFormat(c echo.Context, id string) (string, string) {
+	if i := strings.LastIndex(id, "."); i != -1 {
+		return id[:i], id[i+1:]
+	}
 
-	var buf bytes.Buffer
-	if err = t.Execute(&buf, m); err != nil {
-		return "", err
+	if strings.Contains(c.Request().Header.Get(echo.HeaderAccept), "text/markdown") {
+		return id, "md"
 	}
+	return id, ""
+}
+
+// fingerprintParam returns the requested fingerprint, which in the SHA256:... format may hold an escaped /
+func fingerprintParam(c echo.Context) string {
+	fingerprint, err := url.PathUnescape(c.Param("fingerprint"))
+	if err != nil {
+		return c.Param("fingerprint")
+	}
+	return fingerprint
+}
 
-	return buf.String(), nil
+// wantsJSON reports whether the client asked for a JSON rather than an HTML response
+func wantsJSON(c echo.Context) bool {
+	return strings.Contains(c.Request().Header.Get(echo.HeaderAccept), echo.MIMEApplicationJSON)
 }
 
 func readFile(c echo.Context) (string, error) {
@@ -0,0 +1,186 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/jtanza/post-pigeon/internal/model"
+)
+
+// ErrUnknownJob is returned when asking the Scheduler about a job it doesn't run
+var ErrUnknownJob = errors.New("unknown job")
+
+// Job is a task the Scheduler runs every Interval, delayed by up to Jitter so that jobs sharing an interval
+// don't all run at once. Run returns a short summary of what it did, e.g. how many rows it deleted
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Jitter   time.Duration
+	Run      func(ctx context.Context) (string, error)
+}
+
+// Scheduler runs each of its jobs periodically on a goroutine of its own until the context it was started with
+// is done. Runs of a single job never overlap, whether they're due or triggered by hand
+type Scheduler struct {
+	jobs []*scheduledJob
+	wg   sync.WaitGroup
+}
+
+type scheduledJob struct {
+	Job
+	trigger chan struct{}
+
+	mu     sync.Mutex
+	status model.JobStatus
+}
+
+func NewScheduler(jobs ...Job) *Scheduler {
+	s := &Scheduler{}
+	for _, job := range jobs {
+		s.jobs = append(s.jobs, &scheduledJob{
+			Job:     job,
+			trigger: make(chan struct{}, 1),
+			status:  model.JobStatus{Name: job.Name, Interval: job.Interval.String()},
+		})
+	}
+	return s
+}
+
+// Start schedules every job, running them until ctx is done
+func (s *Scheduler) Start(ctx context.Context) {
+	for _, job := range s.jobs {
+		s.wg.Add(1)
+		go func(job *scheduledJob) {
+			defer s.wg.Done()
+			job.loop(ctx)
+		}(job)
+	}
+}
+
+// Wait blocks until every job has stopped, letting runs in progress finish once the Scheduler's context is done
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+// Trigger runs the job called name as soon as it's not already running, without waiting for it to be due.
+// A job triggered again before it got around to running only runs once
+func (s *Scheduler) Trigger(name string) error {
+	job := s.job(name)
+	if job == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownJob, name)
+	}
+
+	select {
+	case job.trigger <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Status returns the status of every job, in the order they were scheduled
+func (s *Scheduler) Status() []model.JobStatus {
+	statuses := make([]model.JobStatus, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		statuses = append(statuses, job.currentStatus())
+	}
+	return statuses
+}
+
+// JobStatus returns the status of the job called name
+func (s *Scheduler) JobStatus(name string) (model.JobStatus, error) {
+	job := s.job(name)
+	if job == nil {
+		return model.JobStatus{}, fmt.Errorf("%w: %s", ErrUnknownJob, name)
+	}
+	return job.currentStatus(), nil
+}
+
+func (s *Scheduler) job(name string) *scheduledJob {
+	for _, job := range s.jobs {
+		if job.Name == name {
+			return job
+		}
+	}
+	return nil
+}
+
+func (j *scheduledJob) loop(ctx context.Context) {
+	timer := time.NewTimer(j.nextDelay())
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		case <-j.trigger:
+			if !timer.Stop() {
+				<-timer.C
+			}
+		}
+
+		j.run(ctx)
+		timer.Reset(j.nextDelay())
+	}
+}
+
+// nextDelay returns how long until the job is next due, recording it in its status
+func (j *scheduledJob) nextDelay() time.Duration {
+	delay := j.Interval
+	if j.Jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(j.Jitter)))
+	}
+
+	next := time.Now().UTC().Add(delay)
+	j.mu.Lock()
+	j.status.NextRun = &next
+	j.mu.Unlock()
+
+	return delay
+}
+
+func (j *scheduledJob) run(ctx context.Context) {
+	start := time.Now().UTC()
+	j.mu.Lock()
+	j.status.Running = true
+	j.mu.Unlock()
+
+	result, err := j.safeRun(ctx)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.status.Running = false
+	j.status.Runs++
+	j.status.LastRun = &start
+	j.status.LastDuration = time.Since(start).String()
+	j.status.LastResult = result
+	j.status.LastError = ""
+	if err != nil {
+		j.status.Failures++
+		j.status.LastError = err.Error()
+		slog.Error("job failed", "job", j.Name, "error", err)
+	} else {
+		slog.Info("job ran", "job", j.Name, "result", result, "duration", j.status.LastDuration)
+	}
+}
+
+// safeRun runs the job, turning a panic into an error so a single bad run doesn't take its schedule down with it
+func (j *scheduledJob) safeRun(ctx context.Context) (result string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return j.Run(ctx)
+}
+
+func (j *scheduledJob) currentStatus() model.JobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status
+}
@@ -0,0 +1,114 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jtanza/post-pigeon/internal/model"
+)
+
+func TestSchedulerTrigger(t *testing.T) {
+	ran := make(chan struct{})
+	fail := true
+	scheduler := NewScheduler(Job{
+		Name:     "test",
+		Interval: time.Hour,
+		Run: func(ctx context.Context) (string, error) {
+			defer func() { ran <- struct{}{} }()
+			if fail {
+				return "", errors.New("boom")
+			}
+			return "done", nil
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	scheduler.Start(ctx)
+
+	if err := scheduler.Trigger("test"); err != nil {
+		t.Fatal(err)
+	}
+	<-ran
+	awaitRuns(t, scheduler, 1)
+
+	fail = false
+	if err := scheduler.Trigger("test"); err != nil {
+		t.Fatal(err)
+	}
+	<-ran
+	status := awaitRuns(t, scheduler, 2)
+
+	if status.Failures != 1 || status.LastResult != "done" || len(status.LastError) > 0 || status.LastRun == nil {
+		t.Errorf("unexpected job status %+v", status)
+	}
+
+	cancel()
+	scheduler.Wait()
+}
+
+func TestSchedulerRunsDueJobs(t *testing.T) {
+	ran := make(chan struct{}, 1)
+	scheduler := NewScheduler(Job{
+		Name:     "test",
+		Interval: time.Millisecond,
+		Run: func(ctx context.Context) (string, error) {
+			select {
+			case ran <- struct{}{}:
+			default:
+			}
+			return "", nil
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	scheduler.Start(ctx)
+
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Error("expected job to run once due")
+	}
+
+	cancel()
+	scheduler.Wait()
+}
+
+func TestSchedulerRecoversPanics(t *testing.T) {
+	scheduler := NewScheduler(Job{
+		Name:     "test",
+		Interval: time.Hour,
+		Run: func(ctx context.Context) (string, error) {
+			panic("boom")
+		},
+	})
+
+	scheduler.jobs[0].run(context.Background())
+	if status, _ := scheduler.JobStatus("test"); status.Failures != 1 || status.LastError != "panic: boom" {
+		t.Errorf("expected panic to be recorded as a failure, got %+v", status)
+	}
+}
+
+func TestSchedulerUnknownJob(t *testing.T) {
+	scheduler := NewScheduler()
+	if err := scheduler.Trigger("nope"); !errors.Is(err, ErrUnknownJob) {
+		t.Errorf("expected unknown job error, got %v", err)
+	}
+	if _, err := scheduler.JobStatus("nope"); !errors.Is(err, ErrUnknownJob) {
+		t.Errorf("expected unknown job error, got %v", err)
+	}
+}
+
+// awaitRuns waits for the status of the only job of scheduler to record runs, which happens just after the job returns
+func awaitRuns(t *testing.T, scheduler *Scheduler, runs int64) model.JobStatus {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if status := scheduler.Status()[0]; status.Runs == runs && !status.Running {
+			return status
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("job did not complete %d runs", runs)
+	return model.JobStatus{}
+}
@@ -0,0 +1,5 @@
+drop index post_status_publish_at_idx;
+
+alter table post drop column publish_at;
+
+pragma user_version = 9;
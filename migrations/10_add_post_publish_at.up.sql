@@ -0,0 +1,5 @@
+alter table post add column publish_at datetime;
+
+create index post_status_publish_at_idx on post(status, publish_at);
+
+pragma user_version = 10;
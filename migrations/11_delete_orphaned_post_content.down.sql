@@ -0,0 +1 @@
+pragma user_version = 10;
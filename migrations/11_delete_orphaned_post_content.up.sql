@@ -0,0 +1,5 @@
+-- expired posts used to be reaped without their content while foreign keys went unenforced
+delete from post_content where post_uuid not in (select uuid from post);
+delete from post_tag where post_uuid not in (select uuid from post);
+
+pragma user_version = 11;
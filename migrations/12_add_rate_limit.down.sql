@@ -0,0 +1,3 @@
+drop table rate_limit;
+
+pragma user_version = 11;
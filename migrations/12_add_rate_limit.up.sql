@@ -0,0 +1,9 @@
+create table rate_limit (
+  key        text primary key,
+  window_end integer not null,
+  count      integer not null
+);
+
+create index rate_limit_window_end_idx on rate_limit(window_end);
+
+pragma user_version = 12;
@@ -0,0 +1,7 @@
+drop table audit_entry;
+drop table report;
+
+alter table post drop column takedown_reason;
+alter table post drop column taken_down_at;
+
+pragma user_version = 12;
@@ -0,0 +1,32 @@
+alter table post add column taken_down_at datetime;
+alter table post add column takedown_reason text;
+
+create table report (
+  id          integer primary key asc,
+  post_uuid   text not null,
+  reason      text not null,
+  details     text not null default '',
+  status      text not null default 'open',
+  resolved_at datetime,
+  created_at  datetime,
+  updated_at  datetime,
+  deleted_at  datetime,
+  foreign key(post_uuid) references post(uuid) on delete cascade
+);
+
+create index report_post_uuid_idx on report(post_uuid);
+create index report_status_idx on report(status);
+
+create table audit_entry (
+  id         integer primary key asc,
+  action     text not null,
+  actor      text not null,
+  post_uuid  text,
+  details    text not null default '',
+  created_at datetime not null
+);
+
+create index audit_entry_post_uuid_idx on audit_entry(post_uuid);
+create index audit_entry_created_at_idx on audit_entry(created_at);
+
+pragma user_version = 13;
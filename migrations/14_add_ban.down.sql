@@ -0,0 +1,3 @@
+drop table ban;
+
+pragma user_version = 13;
@@ -0,0 +1,11 @@
+create table ban (
+  id          integer primary key asc,
+  fingerprint text not null unique,
+  reason      text not null default '',
+  created_by  text not null,
+  created_at  datetime,
+  updated_at  datetime,
+  deleted_at  datetime
+);
+
+pragma user_version = 14;
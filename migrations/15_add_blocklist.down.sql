@@ -0,0 +1,16 @@
+create table ban (
+  id          integer primary key asc,
+  fingerprint text not null unique,
+  reason      text not null default '',
+  created_by  text not null,
+  created_at  datetime,
+  updated_at  datetime,
+  deleted_at  datetime
+);
+
+insert into ban (fingerprint, reason, created_by, created_at, updated_at)
+  select value, reason, created_by, created_at, updated_at from blocklist_entry where kind = 'fingerprint' and deleted_at is null;
+
+drop table blocklist_entry;
+
+pragma user_version = 14;
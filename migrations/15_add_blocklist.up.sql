@@ -0,0 +1,19 @@
+create table blocklist_entry (
+  id         integer primary key asc,
+  kind       text not null,
+  value      text not null,
+  reason     text not null default '',
+  created_by text not null,
+  created_at datetime,
+  updated_at datetime,
+  deleted_at datetime,
+  unique(kind, value)
+);
+
+-- bans become blocklisted fingerprints
+insert into blocklist_entry (kind, value, reason, created_by, created_at, updated_at)
+  select 'fingerprint', fingerprint, reason, created_by, created_at, updated_at from ban where deleted_at is null;
+
+drop table ban;
+
+pragma user_version = 15;
@@ -0,0 +1,10 @@
+drop trigger audit_entry_append_only;
+
+drop index audit_entry_action_idx;
+drop index audit_entry_fingerprint_idx;
+
+alter table audit_entry drop column ip_hash;
+alter table audit_entry drop column signature;
+alter table audit_entry drop column fingerprint;
+
+pragma user_version = 15;
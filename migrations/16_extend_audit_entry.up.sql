@@ -0,0 +1,14 @@
+alter table audit_entry add column fingerprint text;
+alter table audit_entry add column signature text;
+alter table audit_entry add column ip_hash text;
+
+create index audit_entry_fingerprint_idx on audit_entry(fingerprint);
+create index audit_entry_action_idx on audit_entry(action);
+
+-- entries are only ever added, and dropped once past retention
+create trigger audit_entry_append_only before update on audit_entry
+begin
+  select raise(abort, 'audit entries are append only');
+end;
+
+pragma user_version = 16;
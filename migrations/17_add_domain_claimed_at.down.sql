@@ -0,0 +1,3 @@
+alter table domain_verification drop column claimed_at;
+
+pragma user_version = 16;
@@ -0,0 +1,6 @@
+-- claims that start over are pending from when they were claimed again, not from when they were first made
+alter table domain_verification add column claimed_at datetime;
+
+update domain_verification set claimed_at = created_at;
+
+pragma user_version = 17;
@@ -0,0 +1,3 @@
+alter table post drop column signature;
+
+pragma user_version = 1;
@@ -0,0 +1,3 @@
+alter table post add column signature text;
+
+pragma user_version = 2;
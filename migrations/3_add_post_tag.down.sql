@@ -0,0 +1,3 @@
+drop table post_tag;
+
+pragma user_version = 2;
@@ -0,0 +1,13 @@
+create table post_tag (
+  id         integer primary key asc,
+  post_uuid  text not null,
+  tag        text not null,
+  created_at datetime,
+  updated_at datetime,
+  deleted_at datetime,
+  unique(post_uuid, tag),
+  foreign key(post_uuid) references post(uuid) on delete cascade
+);
+create index post_tag_tag_idx on post_tag(tag);
+
+pragma user_version = 3;
@@ -0,0 +1,6 @@
+drop table handle;
+
+drop index post_fingerprint_slug_idx;
+alter table post drop column slug;
+
+pragma user_version = 3;
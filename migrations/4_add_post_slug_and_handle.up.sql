@@ -0,0 +1,15 @@
+alter table post add column slug text;
+create unique index post_fingerprint_slug_idx on post(fingerprint, slug);
+
+create table handle (
+  id          integer primary key asc,
+  handle      text unique not null,
+  fingerprint text unique not null,
+  key         text not null,
+  signature   text not null,
+  created_at  datetime,
+  updated_at  datetime,
+  deleted_at  datetime
+);
+
+pragma user_version = 4;
@@ -0,0 +1,3 @@
+drop table profile;
+
+pragma user_version = 4;
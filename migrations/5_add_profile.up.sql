@@ -0,0 +1,18 @@
+create table profile (
+  id          integer primary key asc,
+  fingerprint text not null,
+  version     integer not null,
+  key         text not null,
+  document    text not null,
+  signature   text not null,
+  name        text,
+  bio         text,
+  avatar      text,
+  links       text,
+  created_at  datetime,
+  updated_at  datetime,
+  deleted_at  datetime,
+  unique(fingerprint, version)
+);
+
+pragma user_version = 5;
@@ -0,0 +1,3 @@
+drop table key_rotation;
+
+pragma user_version = 5;
@@ -0,0 +1,15 @@
+create table key_rotation (
+  id               integer primary key asc,
+  from_fingerprint text not null unique,
+  to_fingerprint   text not null unique,
+  from_key         text not null,
+  to_key           text not null,
+  statement        text not null,
+  signature        text not null,
+  new_signature    text not null,
+  created_at       datetime,
+  updated_at       datetime,
+  deleted_at       datetime
+);
+
+pragma user_version = 6;
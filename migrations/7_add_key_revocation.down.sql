@@ -0,0 +1,3 @@
+drop table key_revocation;
+
+pragma user_version = 6;
@@ -0,0 +1,14 @@
+create table key_revocation (
+  id          integer primary key asc,
+  fingerprint text not null unique,
+  key         text not null,
+  certificate text not null,
+  signature   text not null,
+  reason      text,
+  successor   text,
+  created_at  datetime,
+  updated_at  datetime,
+  deleted_at  datetime
+);
+
+pragma user_version = 7;
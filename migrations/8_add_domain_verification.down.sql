@@ -0,0 +1,3 @@
+drop table domain_verification;
+
+pragma user_version = 7;
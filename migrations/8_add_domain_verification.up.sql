@@ -0,0 +1,18 @@
+create table domain_verification (
+  id          integer primary key asc,
+  domain      text not null,
+  fingerprint text not null,
+  key         text not null,
+  signature   text not null,
+  status      text not null,
+  checked_at  datetime,
+  verified_at datetime,
+  created_at  datetime,
+  updated_at  datetime,
+  deleted_at  datetime,
+  unique(domain, fingerprint)
+);
+
+create index idx_domain_verification_status on domain_verification(status);
+
+pragma user_version = 8;
@@ -0,0 +1,7 @@
+drop index post_status_idx;
+drop index post_preview_token_idx;
+
+alter table post drop column preview_token;
+alter table post drop column status;
+
+pragma user_version = 8;
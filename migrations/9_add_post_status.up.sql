@@ -0,0 +1,7 @@
+alter table post add column status text not null default 'published';
+alter table post add column preview_token text;
+
+create unique index post_preview_token_idx on post(preview_token);
+create index post_status_idx on post(status);
+
+pragma user_version = 9;
@@ -0,0 +1,10 @@
+// Package migrations holds the migrations of the db schema, embedded so that the binaries know which is the latest
+// wherever they're run from
+package migrations
+
+import "embed"
+
+// FS holds every up and down migration, named N_name.up.sql and N_name.down.sql
+//
+//go:embed *.sql
+var FS embed.FS
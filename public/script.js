@@ -17,6 +17,59 @@ function sendDeletePost() {
     return false
 }
 
+// posts may need a proof of work, a hash of the challenge, title, signature and a proof starting with enough
+// zero bits. we ask for a challenge on submit and solve it before letting the form through
+const postForm = document.querySelector("form[action='/posts'][method='POST']")
+if (postForm) {
+    postForm.addEventListener("submit", async (event) => {
+        if (postForm.elements.proof.value) {
+            return
+        }
+        event.preventDefault()
+
+        const button = document.querySelector("#publish")
+        button.classList.add("is-loading")
+        try {
+            const response = await fetch('/challenges', {headers: {'Accept': 'application/json'}})
+            const challenge = await response.json()
+            if (challenge.difficulty > 0) {
+                postForm.elements.challenge.value = challenge.challenge
+                postForm.elements.proof.value = await solveChallenge(challenge, postForm.elements.title.value,
+                    postForm.elements.signature.value)
+            }
+        } finally {
+            button.classList.remove("is-loading")
+        }
+        postForm.submit()
+    })
+}
+
+async function solveChallenge(challenge, title, signature) {
+    const encoder = new TextEncoder()
+    const stamp = `${challenge.challenge}:${title}:${signature.replace(/\s/g, '')}:`
+    const batch = 1000
+    for (let proof = 0; ; proof += batch) {
+        const hashes = await Promise.all(Array.from({length: batch}, (_, i) =>
+            crypto.subtle.digest('SHA-256', encoder.encode(stamp + (proof + i)))))
+        for (let i = 0; i < batch; i++) {
+            if (leadingZeroBits(new Uint8Array(hashes[i])) >= challenge.difficulty) {
+                return String(proof + i)
+            }
+        }
+    }
+}
+
+function leadingZeroBits(hash) {
+    let zeros = 0
+    for (const b of hash) {
+        if (b !== 0) {
+            return zeros + Math.clz32(b) - 24
+        }
+        zeros += 8
+    }
+    return zeros
+}
+
 // https://bulma.io/documentation/form/file/#docsNav
 const fileInput = document.querySelector("#file-post-upload input[type=file]");
 fileInput.onchange = () => {